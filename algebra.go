@@ -0,0 +1,356 @@
+package zzglob
+
+import (
+	"slices"
+	"strings"
+	"unicode/utf8"
+)
+
+// Intersects reports whether there is a path that both a and b match. Use
+// IntersectionExample to find such a path.
+func Intersects(a, b *Pattern) bool {
+	_, ok := IntersectionExample(a, b)
+	return ok
+}
+
+// IntersectionExample returns a path that both a and b match, and true, or
+// "", false if there is no such path. The path is one of the shortest such
+// paths, preferring lowercase letters where there is a choice of characters.
+func IntersectionExample(a, b *Pattern) (string, bool) {
+	return pairSearch(fullDFA(a), fullDFA(b), func(accA, accB bool) bool {
+		return accA && accB
+	}, func(sa, sb *state) bool {
+		return sa != nil && sb != nil
+	})
+}
+
+// Subsumes reports whether a matches every path that b matches (and so b is
+// redundant when used alongside a).
+func Subsumes(a, b *Pattern) bool {
+	_, found := pairSearch(fullDFA(a), fullDFA(b), func(accA, accB bool) bool {
+		return accB && !accA
+	}, func(_, sb *state) bool {
+		return sb != nil
+	})
+	return !found
+}
+
+// Equivalent reports whether a and b match exactly the same paths, even if
+// they are written differently (e.g. "{a,b}*" and "[ab]*").
+func Equivalent(a, b *Pattern) bool {
+	_, found := pairSearch(fullDFA(a), fullDFA(b), func(accA, accB bool) bool {
+		return accA != accB
+	}, func(sa, sb *state) bool {
+		return sa != nil || sb != nil
+	})
+	return !found
+}
+
+// fullMachine returns an automaton matching whole paths (including the root)
+// for the pattern. The pattern's automaton is reused, not copied.
+func fullMachine(p *Pattern) *state {
+	initial := &state{}
+	cur := initial
+	for _, r := range p.root {
+		next := &state{}
+		if p.inputConfig.caseInsensitive {
+			for _, x := range foldRanges(literalExp(r).runeRanges()) {
+				cur.Out = append(cur.Out, edge{Expr: x.exp(), State: next})
+			}
+		} else {
+			cur.Out = append(cur.Out, edge{Expr: literalExp(r), State: next})
+		}
+		cur = next
+	}
+	if p.initial == nil {
+		cur.Accept = true
+	} else {
+		cur.Out = append(cur.Out, edge{State: p.initial})
+	}
+	return initial
+}
+
+// fullDFA returns a deterministic automaton matching whole paths for the
+// pattern.
+func fullDFA(p *Pattern) *state {
+	return determinise(fullMachine(p), allRanges, false)
+}
+
+// pairTransitions calls f for each interval of runes for which the pair of
+// deterministic automaton states a and b (either may be nil, meaning a dead
+// state) transitions to the same pair of states, na and nb (either of which
+// may be nil). Intervals where both would be nil are skipped.
+func pairTransitions(a, b *state, f func(lo, hi rune, na, nb *state)) {
+	var bounds []rune
+	for _, s := range []*state{a, b} {
+		if s == nil {
+			continue
+		}
+		for _, e := range s.Out {
+			for _, r := range e.Expr.runeRanges() {
+				bounds = append(bounds, r.lo, r.hi+1)
+			}
+		}
+	}
+	slices.Sort(bounds)
+	bounds = slices.Compact(bounds)
+
+	next := func(s *state, r rune) *state {
+		if s == nil {
+			return nil
+		}
+		for _, e := range s.Out {
+			if e.Expr.match(r) {
+				return e.State
+			}
+		}
+		return nil
+	}
+	for i := 0; i+1 < len(bounds); i++ {
+		lo, hi := bounds[i], bounds[i+1]-1
+		na, nb := next(a, lo), next(b, lo)
+		if na == nil && nb == nil {
+			continue
+		}
+		f(lo, hi, na, nb)
+	}
+}
+
+// pairSearch searches (breadth-first) the product of two deterministic
+// automata for a path where found reports true for whether each accepts.
+// Only pairs of states for which explore reports true are searched. It
+// returns the first such path found.
+func pairSearch(a, b *state, found func(accA, accB bool) bool, explore func(sa, sb *state) bool) (string, bool) {
+	type pair struct{ a, b *state }
+	type step struct {
+		prev pair
+		r    rune
+	}
+	from := map[pair]step{}
+	start := pair{a, b}
+	seen := map[pair]bool{start: true}
+	q := []pair{start}
+	for len(q) > 0 {
+		p := q[0]
+		q = q[1:]
+		if found(p.a != nil && p.a.Accept, p.b != nil && p.b.Accept) {
+			// Follow the steps back to the start.
+			var rs []rune
+			for p != start {
+				st := from[p]
+				rs = append(rs, st.r)
+				p = st.prev
+			}
+			slices.Reverse(rs)
+			return string(rs), true
+		}
+		pairTransitions(p.a, p.b, func(lo, hi rune, na, nb *state) {
+			n := pair{na, nb}
+			if seen[n] || !explore(na, nb) {
+				return
+			}
+			seen[n] = true
+			from[n] = step{prev: p, r: exampleRune(lo, hi)}
+			q = append(q, n)
+		})
+	}
+	return "", false
+}
+
+// exampleRune picks a readable rune from the range lo to hi (inclusive), for
+// use in example paths.
+func exampleRune(lo, hi rune) rune {
+	const preferred = "abcdefghijklmnopqrstuvwxyz0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZ_-."
+	if i := strings.IndexFunc(preferred, func(r rune) bool {
+		return lo <= r && r <= hi
+	}); i >= 0 {
+		return rune(preferred[i])
+	}
+	// Otherwise, the first valid printable-ish rune.
+	for r := max(lo, ' '+1); r <= hi && r < lo+1024; r++ {
+		if utf8.ValidRune(r) {
+			return r
+		}
+	}
+	return lo
+}
+
+// And returns a pattern that matches the paths matched by every one of the
+// patterns. With no patterns, it matches every path.
+func And(patterns ...*Pattern) *Pattern {
+	if len(patterns) == 0 {
+		return Not(Or())
+	}
+	m := fullDFA(patterns[0])
+	for _, p := range patterns[1:] {
+		m = product(m, fullDFA(p))
+	}
+	trim(m)
+	return combined("And", patterns, longestRoot(patterns), m)
+}
+
+// longestRoot returns the longest of the patterns' roots (as directories), if
+// each is a prefix of it. Since every path matched by And starts with every
+// root, walking can start there. If the roots disagree (so And matches
+// nothing), it returns the common root.
+func longestRoot(patterns []*Pattern) string {
+	root := ""
+	for _, p := range patterns {
+		r := commonRoot([]*Pattern{p})
+		switch {
+		case strings.HasPrefix(r, root):
+			root = r
+		case !strings.HasPrefix(root, r):
+			return commonRoot(patterns)
+		}
+	}
+	return root
+}
+
+// Or returns a pattern that matches the paths matched by any of the
+// patterns. With no patterns, it matches nothing. (To find out which pattern
+// matched, use a PatternSet.)
+func Or(patterns ...*Pattern) *Pattern {
+	m := &state{}
+	for _, p := range patterns {
+		m.Out = append(m.Out, edge{State: fullMachine(p)})
+	}
+	return combined("Or", patterns, commonRoot(patterns), m)
+}
+
+// Not returns a pattern that matches every path that p doesn't match. Its root
+// is empty, since it matches paths that don't start with p's root.
+func Not(p *Pattern) *Pattern {
+	m := determinise(fullMachine(p), allRanges, true)
+	visit(m, func(s *state) {
+		s.Accept = !s.Accept
+	})
+	trim(m)
+	return combined("Not", []*Pattern{p}, "", m)
+}
+
+// commonRoot returns the longest common directory (empty, or ending in /) of
+// the patterns' roots.
+func commonRoot(patterns []*Pattern) string {
+	root := ""
+	for i, p := range patterns {
+		r := p.root
+		if p.initial == nil {
+			// A root that is the whole path (e.g. a/b, or a/b/) can only be
+			// matched from its parent.
+			r = strings.TrimSuffix(r, "/")
+		}
+		if p.inputConfig.caseInsensitive {
+			// The root is matched case-insensitively, which cutRoot
+			// wouldn't do.
+			r = rootAnchor(r)
+		}
+		if i == 0 {
+			root = r
+		} else {
+			root = commonPrefix(root, r)
+		}
+	}
+	return root[:strings.LastIndex(root, "/")+1]
+}
+
+// combined returns a pattern, with the given root, for the automaton m that
+// matches whole paths.
+func combined(op string, args []*Pattern, root string, m *state) *Pattern {
+	initial := &state{}
+	for s := range matchSegment(singleton(m), root) {
+		initial.Out = append(initial.Out, edge{State: s})
+	}
+
+	names := make([]string, 0, len(args))
+	for _, p := range args {
+		names = append(names, p.inputPattern)
+	}
+	cfg := defaultParseConfig
+	cfg.expandTilde = false
+	return &Pattern{
+		root:         root,
+		initial:      initial,
+		dfa:          newLazyDFA(initial),
+		inputPattern: op + "(" + strings.Join(names, ", ") + ")",
+		inputConfig:  cfg,
+	}
+}
+
+// product returns a deterministic automaton that matches inputs matched by
+// both a and b, which must be deterministic.
+func product(a, b *state) *state {
+	type pair struct{ a, b *state }
+	states := make(map[pair]*state)
+	var q []pair
+	get := func(p pair) *state {
+		if s := states[p]; s != nil {
+			return s
+		}
+		s := &state{Accept: p.a.Accept && p.b.Accept}
+		states[p] = s
+		q = append(q, p)
+		return s
+	}
+
+	initial := get(pair{a, b})
+	for len(q) > 0 {
+		p := q[0]
+		q = q[1:]
+		s := states[p]
+		pairTransitions(p.a, p.b, func(lo, hi rune, na, nb *state) {
+			if na == nil || nb == nil {
+				return
+			}
+			target := get(pair{na, nb})
+			// Extend the previous edge if it goes to the same place.
+			if n := len(s.Out); n > 0 && s.Out[n-1].State == target {
+				if last := s.Out[n-1].Expr.runeRanges(); last[len(last)-1].hi+1 == lo {
+					s.Out[n-1].Expr = rangeExp{last[0].lo, hi}.exp()
+					return
+				}
+			}
+			s.Out = append(s.Out, edge{Expr: rangeExp{lo, hi}.exp(), State: target})
+		})
+	}
+	return initial
+}
+
+// trim removes edges to states from which no accepting state can be reached,
+// so that walking can stop as soon as nothing more could match.
+func trim(initial *state) {
+	// Find which states can reach which, in reverse.
+	var all []*state
+	preds := make(map[*state][]*state)
+	visit(initial, func(s *state) {
+		all = append(all, s)
+		for _, e := range s.Out {
+			preds[e.State] = append(preds[e.State], s)
+		}
+	})
+
+	live := make(map[*state]bool)
+	var q []*state
+	for _, s := range all {
+		if s.Accept {
+			live[s] = true
+			q = append(q, s)
+		}
+	}
+	for len(q) > 0 {
+		s := q[0]
+		q = q[1:]
+		for _, p := range preds[s] {
+			if !live[p] {
+				live[p] = true
+				q = append(q, p)
+			}
+		}
+	}
+
+	for _, s := range all {
+		s.Out = slices.DeleteFunc(s.Out, func(e edge) bool {
+			return !live[e.State]
+		})
+	}
+}
@@ -0,0 +1,257 @@
+package zzglob
+
+import (
+	"sort"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestIntersects(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want bool
+	}{
+		{"src/**/*.go", "src/gen/*", true},
+		{"src/**/*.go", "docs/*", false},
+		{"*.go", "*.md", false},
+		{"*.go", "main.*", true},
+		{"a/b", "a/b", true},
+		{"a/b", "a/c", false},
+		{"a/b", "a/*", true},
+		{"/abs/*", "abs/*", false},
+		{"**", "x/y/z", true},
+		{"**/*_test.go", "internal/**", true},
+		{"[a-c]?", "[d-f]?", false},
+		{"{foo,bar}/x", "b*/?", true},
+		{"foo*/", "foo*", false},
+	}
+
+	for _, test := range tests {
+		a, b := MustParse(test.a), MustParse(test.b)
+		if got := Intersects(a, b); got != test.want {
+			t.Errorf("Intersects(%q, %q) = %t, want %t", test.a, test.b, got, test.want)
+		}
+		if got := Intersects(b, a); got != test.want {
+			t.Errorf("Intersects(%q, %q) = %t, want %t", test.b, test.a, got, test.want)
+		}
+
+		example, ok := IntersectionExample(a, b)
+		if ok != test.want {
+			t.Errorf("IntersectionExample(%q, %q) = %q, %t, want ok = %t", test.a, test.b, example, ok, test.want)
+		}
+		if !ok {
+			continue
+		}
+		if !a.Match(example) || !b.Match(example) {
+			t.Errorf("IntersectionExample(%q, %q) = %q, but it doesn't match both (%t, %t)", test.a, test.b, example, a.Match(example), b.Match(example))
+		}
+	}
+}
+
+func TestIntersectionExample(t *testing.T) {
+	tests := []struct {
+		a, b, want string
+	}{
+		{"src/**/*.go", "src/gen/*", "src/gen/.go"},
+		{"*.go", "main.*", "main.go"},
+		{"a/*", "*/b", "a/b"},
+		{"x/**", "**/y", "x/y"},
+	}
+
+	for _, test := range tests {
+		got, ok := IntersectionExample(MustParse(test.a), MustParse(test.b))
+		if !ok || got != test.want {
+			t.Errorf("IntersectionExample(%q, %q) = %q, %t, want %q, true", test.a, test.b, got, ok, test.want)
+		}
+	}
+}
+
+func TestIntersects_CaseInsensitive(t *testing.T) {
+	a, err := Parse("SRC/*.GO", CaseInsensitive(true))
+	if err != nil {
+		t.Fatalf("Parse(SRC/*.GO) = %v", err)
+	}
+	b := MustParse("src/main.go")
+	example, ok := IntersectionExample(a, b)
+	if !ok || example != "src/main.go" {
+		t.Errorf("IntersectionExample(%v, %v) = %q, %t, want %q, true", a.inputPattern, b.inputPattern, example, ok, "src/main.go")
+	}
+}
+
+func TestSubsumes(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want bool
+	}{
+		{"src/**", "src/**/testdata/**", true},
+		{"src/**/testdata/**", "src/**", false},
+		{"**/*.go", "src/*.go", true},
+		{"src/*.go", "**/*.go", false},
+		{"*", "a", true},
+		{"a", "*", false},
+		{"a/b", "a/b", true},
+		{"{a,b,c}", "[ab]", true},
+		{"[ab]", "{a,b,c}", false},
+		{"**", "/abs/path", true},
+		{"*", "/abs", false},
+		{"src/*", "docs/*", false},
+		{"a/**/b", "a/b", true},
+		{"a/**/b", "a/x/y/b", true},
+		{"?", "??", false},
+	}
+
+	for _, test := range tests {
+		if got := Subsumes(MustParse(test.a), MustParse(test.b)); got != test.want {
+			t.Errorf("Subsumes(%q, %q) = %t, want %t", test.a, test.b, got, test.want)
+		}
+	}
+}
+
+func TestEquivalent(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want bool
+	}{
+		{"{a,b}*", "[ab]*", true},
+		{"a/**/b", "a/{,**/}b", true},
+		{"a/b", "{a/b,a/b}", true},
+		{"a/**", "a/**/**", true},
+		{"a/*", "a/**", false},
+		{"x/*.go", "x/*.{go,md}", false},
+		{"src/*", "src/[^/]*", false}, // [^/] can't match /, but also not empty
+		{"**", "**/*", true},          // * can match an empty segment
+		{"**", "*", false},
+	}
+
+	for _, test := range tests {
+		a, b := MustParse(test.a), MustParse(test.b)
+		if got := Equivalent(a, b); got != test.want {
+			t.Errorf("Equivalent(%q, %q) = %t, want %t", test.a, test.b, got, test.want)
+		}
+		if got := Equivalent(b, a); got != test.want {
+			t.Errorf("Equivalent(%q, %q) = %t, want %t", test.b, test.a, got, test.want)
+		}
+	}
+}
+
+func TestCombinators_Match(t *testing.T) {
+	src := MustParse("src/**/*.go")
+	tests := MustParse("**/*_test.go")
+	gen := MustParse("src/gen/**")
+
+	patterns := []struct {
+		name string
+		p    *Pattern
+		// want reports whether the combined pattern should match, given
+		// whether src, tests, and gen match.
+		want func(src, tests, gen bool) bool
+	}{
+		{"And(src, tests)", And(src, tests), func(s, t, _ bool) bool { return s && t }},
+		{"And(src, Not(tests))", And(src, Not(tests)), func(s, t, _ bool) bool { return s && !t }},
+		{"Or(tests, gen)", Or(tests, gen), func(_, t, g bool) bool { return t || g }},
+		{"Not(src)", Not(src), func(s, _, _ bool) bool { return !s }},
+		{"Not(Not(src))", Not(Not(src)), func(s, _, _ bool) bool { return s }},
+		{"And(src, Not(Or(tests, gen)))", And(src, Not(Or(tests, gen))), func(s, t, g bool) bool { return s && !(t || g) }},
+		{"And()", And(), func(_, _, _ bool) bool { return true }},
+		{"Or()", Or(), func(_, _, _ bool) bool { return false }},
+	}
+
+	paths := []string{
+		"", "src/", "src/a.go", "src/a_test.go", "src/x/y/b.go", "src/x/y/b_test.go",
+		"src/gen/c.go", "src/gen/c_test.go", "src/gen/", "docs/a.md", "a_test.go",
+		"/src/a.go", "src/a.go/",
+	}
+
+	for _, pt := range patterns {
+		for _, path := range paths {
+			want := pt.want(src.Match(path), tests.Match(path), gen.Match(path))
+			if got := pt.p.Match(path); got != want {
+				t.Errorf("%s.Match(%q) = %t, want %t", pt.name, path, got, want)
+			}
+		}
+	}
+}
+
+func TestCombinators_Roots(t *testing.T) {
+	tests := []struct {
+		p    *Pattern
+		want string
+	}{
+		{And(MustParse("src/a/*.go"), MustParse("src/b/**")), "src/"},
+		{And(MustParse("src/**"), MustParse("src/a/*.go"), Not(MustParse("*_test.go"))), "src/a/"},
+		{Or(MustParse("src/a/*.go"), MustParse("src/a/b/**")), "src/a/"},
+		{Or(MustParse("/etc/*.conf"), MustParse("docs/*")), ""},
+		{Or(MustParse("a/b/"), MustParse("a/b/*")), "a/"},
+		{Not(MustParse("src/**")), ""},
+	}
+
+	for _, test := range tests {
+		if got := test.p.root; got != test.want {
+			t.Errorf("%s root = %q, want %q", test.p.inputPattern, got, test.want)
+		}
+	}
+}
+
+func TestCombinators_Equivalent(t *testing.T) {
+	tests := []struct {
+		a    *Pattern
+		b    string
+		want bool
+	}{
+		{Or(MustParse("a/*"), MustParse("b/*")), "{a,b}/*", true},
+		{And(MustParse("*.go"), MustParse("main.*")), "main.{go,*.go}", true},
+		{And(MustParse("[a-m]*"), MustParse("[h-z]*")), "[h-m]*", true},
+		{And(MustParse("**"), Not(MustParse("**/*"))), "x", false},
+		{Not(Or(MustParse("**"))), "{}", false},
+	}
+
+	for _, test := range tests {
+		if got := Equivalent(test.a, MustParse(test.b)); got != test.want {
+			t.Errorf("Equivalent(%s, %q) = %t, want %t", test.a.inputPattern, test.b, got, test.want)
+		}
+	}
+}
+
+func TestCombinators_Glob(t *testing.T) {
+	fsys := &readDirRecorder{FS: deepMapFS(3, 2)}
+	p := And(MustParse("src/**/*.go"), Not(MustParse("**/*_test.go")), Not(MustParse("src/d1/**")))
+
+	var got walkFuncCalls
+	if err := p.Glob(got.walkFunc, traceLogOpt, WithFilesystem(fsys)); err != nil {
+		t.Fatalf("Glob(...) = %v", err)
+	}
+	got.sortCalls()
+
+	var want []walkFuncArgs
+	for name := range fsys.FS.(fstest.MapFS) {
+		if p.Match(name) {
+			want = append(want, walkFuncArgs{Path: name})
+		}
+	}
+	sort.Slice(want, func(i, j int) bool { return want[i].Path < want[j].Path })
+
+	if len(want) == 0 {
+		t.Fatal("pattern matches nothing in the test filesystem")
+	}
+	if diff := cmp.Diff(got.calls, want); diff != "" {
+		t.Errorf("walked paths diff (-got +want):\n%s", diff)
+	}
+
+	// The walk starts at src, and prunes src/d1.
+	for _, dir := range fsys.reads {
+		if dir == "." || strings.HasPrefix(dir, "src/d1") {
+			t.Errorf("Glob read directory %q, but it shouldn't have", dir)
+		}
+	}
+
+	var sb strings.Builder
+	if err := p.WriteDot(&sb, nil); err != nil {
+		t.Errorf("WriteDot(...) = %v", err)
+	}
+	if caps, ok := p.MatchCaptures("src/a.go"); !ok || len(caps) != 0 {
+		t.Errorf("MatchCaptures(src/a.go) = %v, %t, want [], true", caps, ok)
+	}
+}
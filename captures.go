@@ -0,0 +1,166 @@
+package zzglob
+
+import (
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// MatchCaptures is like Match, but also returns the text matched by each
+// wildcard, character class, and alternation in the pattern. These are
+// numbered from left to right by where they start in the pattern (nested
+// alternations and extended globs are numbered after the group containing
+// them), and there are no named groups. For example,
+//
+//	photos/**/*.jpeg
+//
+// matching "photos/2023/trip/beach.jpeg" captures "2023/trip" (for `**`) and
+// "beach" (for `*`). Wildcards are greedy, and an alternative that was not
+// used captures the empty string. The `{,**/}` implied by `/**/` (and the
+// `**/` implied by MatchBase) is not itself a group, and a group within a
+// repeated segment (including `**{n,m}`, which repeats `*/`) captures its last
+// repetition. If the path doesn't match, MatchCaptures returns nil, false.
+func (p *Pattern) MatchCaptures(path string) ([]string, bool) {
+	if !p.Match(path) {
+		return nil, false
+	}
+	if p.initial == nil {
+		return []string{}, true
+	}
+
+	rem, _ := p.cutRoot(path)
+	initial, groups := p.captureMachine()
+	slots := captureSlots(initial, rem, 2*groups)
+	if slots == nil {
+		// Match and the capturing machine disagree. This shouldn't happen.
+		return nil, false
+	}
+	caps := make([]string, groups)
+	for i := range caps {
+		if start, end := slots[2*i], slots[2*i+1]; start >= 0 && end >= start {
+			caps[i] = rem[start:end]
+		}
+	}
+	return caps, true
+}
+
+// thread is a state and the capture slots recorded along the way there.
+type thread struct {
+	s    *state
+	caps []int
+}
+
+// captureSlots simulates the tagged automaton on s, keeping only the
+// highest-priority thread for each state (edges earlier in Out have higher
+// priority). It returns the slots (byte offsets into s, or -1 if unset) of
+// the highest-priority accepting thread, or nil if s is not accepted.
+func captureSlots(initial *state, s string, nslots int) []int {
+	caps := make([]int, nslots)
+	for i := range caps {
+		caps[i] = -1
+	}
+
+	var curr, next []thread
+	curr = addThread(curr, make(map[*state]bool), initial, caps, 0)
+	for i, r := range s {
+		pos := i + utf8.RuneLen(r)
+		seen := make(map[*state]bool)
+		next = next[:0]
+		for _, th := range curr {
+			for _, e := range th.s.Out {
+				if e.Expr != nil && e.Expr.match(r) {
+					next = addThread(next, seen, e.State, th.caps, pos)
+				}
+			}
+		}
+		curr, next = next, curr
+		if len(curr) == 0 {
+			return nil
+		}
+	}
+
+	for _, th := range curr {
+		if th.s.Accept {
+			return th.caps
+		}
+	}
+	return nil
+}
+
+// addThread appends threads for s and every state reachable from s by nil
+// edges (in priority order), recording pos in the slots of tagged edges.
+func addThread(list []thread, seen map[*state]bool, s *state, caps []int, pos int) []thread {
+	if seen[s] {
+		return list
+	}
+	seen[s] = true
+	list = append(list, thread{s: s, caps: caps})
+	for _, e := range s.Out {
+		if e.Expr != nil {
+			continue
+		}
+		c := caps
+		if e.Tag != 0 {
+			c = append([]int(nil), caps...)
+			c[e.Tag-1] = pos
+		}
+		list = addThread(list, seen, e.State, c, pos)
+	}
+	return list
+}
+
+// Expand returns the template with each $n or ${n} replaced with captures[n-1]
+// (e.g. as returned by MatchCaptures). Out-of-range references are replaced
+// with the empty string, and $$ is a literal $. A $ not followed by a
+// reference is copied unchanged.
+func (p *Pattern) Expand(template string, captures []string) string {
+	var sb strings.Builder
+	for {
+		before, after, found := strings.Cut(template, "$")
+		sb.WriteString(before)
+		if !found {
+			return sb.String()
+		}
+		template = after
+
+		if strings.HasPrefix(template, "$") {
+			sb.WriteByte('$')
+			template = template[1:]
+			continue
+		}
+
+		num, rest, ok := cutCaptureRef(template)
+		if !ok {
+			sb.WriteByte('$')
+			continue
+		}
+		if n, err := strconv.Atoi(num); err == nil && n >= 1 && n <= len(captures) {
+			sb.WriteString(captures[n-1])
+		}
+		template = rest
+	}
+}
+
+// cutCaptureRef parses the number at the start of s (after a $), either as
+// digits or digits within braces.
+func cutCaptureRef(s string) (num, rest string, ok bool) {
+	braced := strings.HasPrefix(s, "{")
+	if braced {
+		s = s[1:]
+	}
+	i := 0
+	for i < len(s) && '0' <= s[i] && s[i] <= '9' {
+		i++
+	}
+	if i == 0 {
+		return "", "", false
+	}
+	num, rest = s[:i], s[i:]
+	if braced {
+		if !strings.HasPrefix(rest, "}") {
+			return "", "", false
+		}
+		rest = rest[1:]
+	}
+	return num, rest, true
+}
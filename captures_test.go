@@ -0,0 +1,96 @@
+package zzglob
+
+import (
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestMatchCaptures(t *testing.T) {
+	tests := []struct {
+		pattern, path string
+		opts          []ParseOption
+		want          []string
+		wantOK        bool
+	}{
+		{"photos/**/*.jpeg", "photos/2023/trip/beach.jpeg", nil, []string{"2023/trip", "beach"}, true},
+		{"photos/**/*.jpeg", "photos/beach.jpeg", nil, []string{"", "beach"}, true},
+		{"photos/**/*.jpeg", "photos/beach.png", nil, nil, false},
+		{"**/*.go", "a/b/c.go", nil, []string{"a/b", "c"}, true},
+		{"**/*.go", "c.go", nil, []string{"", "c"}, true},
+		{"a/b", "a/b", nil, []string{}, true},
+		{"a/b", "a/c", nil, nil, false},
+		{"*-*.txt", "x-y-z.txt", nil, []string{"x-y", "z"}, true},
+		{"?x*", "axbc", nil, []string{"a", "bc"}, true},
+		{"[abc]*", "bat", nil, []string{"b", "at"}, true},
+		{"[^abc]*", "cat", nil, nil, false},
+		{"[^abc]*", "dog", nil, []string{"d", "og"}, true},
+		{"{foo,bar}/*", "bar/x", nil, []string{"bar", "x"}, true},
+		{"{foo,b*}/*", "baz/x", nil, []string{"baz", "az", "x"}, true},
+		{"{foo,b*}/*", "foo/x", nil, []string{"foo", "", "x"}, true},
+		{"x/{1..3}.png", "x/2.png", []ParseOption{AllowBraceSequence(true)}, []string{"2"}, true},
+		{"frame<0-299>.png", "frame042.png", []ParseOption{AllowNumericRange(true)}, []string{"042"}, true},
+		{"!(*_test).go", "main.go", []ParseOption{AllowExtGlob(true)}, []string{"main", ""}, true},
+		{"+(ab)c", "ababc", []ParseOption{AllowExtGlob(true)}, []string{"abab"}, true},
+		{"src/**{0,2}/*.go", "src/x/y/a.go", []ParseOption{AllowSegmentRepetition(true)}, []string{"y", "a"}, true},
+		{"Photos/*.JPEG", "photos/beach.jpeg", []ParseOption{CaseInsensitive(true)}, []string{"beach"}, true},
+		{"*.txt", "x/y/a.txt", []ParseOption{MatchBase(true)}, []string{"a"}, true},
+		{"*.txt", ".a.txt", []ParseOption{MatchDotfiles(false)}, nil, false},
+		{"*/", "dir/", nil, []string{"dir"}, true},
+	}
+
+	for _, test := range tests {
+		p, err := Parse(test.pattern, test.opts...)
+		if err != nil {
+			t.Fatalf("Parse(%q) error = %v", test.pattern, err)
+		}
+
+		got, gotOK := p.MatchCaptures(test.path)
+		if gotOK != test.wantOK {
+			t.Errorf("(%q).MatchCaptures(%q) ok = %v, want %v", test.pattern, test.path, gotOK, test.wantOK)
+		}
+		if diff := cmp.Diff(got, test.want); diff != "" {
+			t.Errorf("(%q).MatchCaptures(%q) diff (-got +want):\n%s", test.pattern, test.path, diff)
+		}
+		if gotOK != p.Match(test.path) {
+			t.Errorf("(%q).MatchCaptures(%q) ok = %v, but Match = %v", test.pattern, test.path, gotOK, !gotOK)
+		}
+	}
+}
+
+func TestExpand(t *testing.T) {
+	caps := []string{"2023/trip", "beach"}
+	tests := []struct {
+		template, want string
+	}{
+		{"$2-$1.jpg", "beach-2023/trip.jpg"},
+		{"${1}0/${2}", "2023/trip0/beach"},
+		{"$10", ""},
+		{"$3", ""},
+		{"$0", ""},
+		{"$$1", "$1"},
+		{"$x", "$x"},
+		{"${1", "${1"},
+		{"$", "$"},
+		{"no refs", "no refs"},
+	}
+
+	p := MustParse("photos/**/*.jpeg")
+	for _, test := range tests {
+		if got := p.Expand(test.template, caps); got != test.want {
+			t.Errorf("Expand(%q, %q) = %q, want %q", test.template, caps, got, test.want)
+		}
+	}
+}
+
+func TestMatchCaptures_DoesNotChangeMatch(t *testing.T) {
+	// Building the capturing machine must not affect the matching one.
+	p := MustParse("a/{b,c*}/**/d")
+	before := p.String()
+	if _, ok := p.MatchCaptures("a/cx/y/d"); !ok {
+		t.Errorf("MatchCaptures(%q) = _, false, want true", "a/cx/y/d")
+	}
+	if after := p.String(); after != before {
+		t.Errorf("p.String() changed after MatchCaptures:\nbefore: %s\nafter: %s", before, after)
+	}
+}
@@ -15,6 +15,7 @@ package main
 import (
 	"flag"
 	"fmt"
+	"io"
 	"io/fs"
 	"os"
 	"time"
@@ -23,43 +24,53 @@ import (
 )
 
 func main() {
-	includePattern := flag.String("include", "", "Glob pattern for matching files to include")
-	excludePattern := flag.String("exclude", "", "Glob pattern for matching files or directories to exclude")
-	listing := flag.Bool("l", false, "If enabled, extra file information is printed for each match")
-	enableTrace := flag.Bool("trace", false, "If enabled, tracing information is logged to stderr")
-	flag.Parse()
+	os.Exit(run(os.Args[1:], os.Stdout, os.Stderr))
+}
+
+// run runs the command with the arguments (not including the program name),
+// and returns the exit status.
+func run(args []string, stdout, stderr io.Writer) int {
+	flags := flag.NewFlagSet("zzglob", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+	includePattern := flags.String("include", "", "Glob pattern for matching files to include")
+	excludePattern := flags.String("exclude", "", "Glob pattern for matching files or directories to exclude")
+	listing := flags.Bool("l", false, "If enabled, extra file information is printed for each match")
+	enableTrace := flags.Bool("trace", false, "If enabled, tracing information is logged to stderr")
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
 
 	incl, err := zzglob.Parse(*includePattern)
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "Couldn't parse pattern %q: %v\n", *includePattern, err)
-		os.Exit(1)
+		fmt.Fprintf(stderr, "Couldn't parse pattern %q: %v\n", *includePattern, err)
+		return 1
 	}
 	if *enableTrace {
-		incl.WriteDot(os.Stderr, nil)
+		incl.WriteDot(stderr, nil)
 	}
 
 	var opts []zzglob.GlobOption
 	if *enableTrace {
-		opts = append(opts, zzglob.WithTraceLogs(os.Stderr))
+		opts = append(opts, zzglob.WithTraceLogs(stderr))
 	}
 	var excl *zzglob.Pattern
 	if *excludePattern != "" {
 		ep, err := zzglob.Parse(*excludePattern)
 		if err != nil {
-			fmt.Fprintf(os.Stderr, "Couldn't parse exclude pattern %q: %v\n", *excludePattern, err)
-			os.Exit(1)
+			fmt.Fprintf(stderr, "Couldn't parse exclude pattern %q: %v\n", *excludePattern, err)
+			return 1
 		}
 		excl = ep
 		opts = append(opts, zzglob.WalkIntermediateDirs(true))
 		if *enableTrace {
-			excl.WriteDot(os.Stderr, nil)
+			excl.WriteDot(stderr, nil)
 		}
 	}
 
 	err = incl.Glob(
 		func(path string, d fs.DirEntry, err error) error {
 			if err != nil {
-				fmt.Fprintf(os.Stderr, "Error at path %q: %v\n", path, err)
+				fmt.Fprintf(stderr, "Error at path %q: %v\n", path, err)
 				return nil
 			}
 
@@ -79,12 +90,12 @@ func main() {
 			if *listing {
 				fi, err := d.Info()
 				if err != nil {
-					fmt.Fprintf(os.Stderr, "Error at path %q: %v\n", path, err)
+					fmt.Fprintf(stderr, "Error at path %q: %v\n", path, err)
 					return nil
 				}
-				fmt.Printf("%v\t%d\t%s\t%s\n", fi.Mode(), fi.Size(), fi.ModTime().Format(time.RFC3339), path)
+				fmt.Fprintf(stdout, "%v\t%d\t%s\t%s\n", fi.Mode(), fi.Size(), fi.ModTime().Format(time.RFC3339), path)
 			} else {
-				fmt.Println(path)
+				fmt.Fprintln(stdout, path)
 			}
 
 			return nil
@@ -92,6 +103,7 @@ func main() {
 		opts...,
 	)
 	if err != nil {
-		fmt.Fprintf(os.Stderr, "Couldn't perform file system walk: %v\n", err)
+		fmt.Fprintf(stderr, "Couldn't perform file system walk: %v\n", err)
 	}
+	return 0
 }
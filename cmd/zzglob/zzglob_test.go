@@ -0,0 +1,88 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+// chdirTree creates the files in a temporary directory, and changes to it
+// for the rest of the test.
+func chdirTree(t *testing.T, files ...string) {
+	t.Helper()
+	dir := t.TempDir()
+	for _, f := range files {
+		name := filepath.Join(dir, filepath.FromSlash(f))
+		if err := os.MkdirAll(filepath.Dir(name), 0o755); err != nil {
+			t.Fatalf("os.MkdirAll(%q) = %v", filepath.Dir(name), err)
+		}
+		if err := os.WriteFile(name, nil, 0o644); err != nil {
+			t.Fatalf("os.WriteFile(%q) = %v", name, err)
+		}
+	}
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("os.Getwd() = %v", err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatalf("os.Chdir(%q) = %v", dir, err)
+	}
+	t.Cleanup(func() { os.Chdir(wd) })
+}
+
+func TestRun_Exclude(t *testing.T) {
+	chdirTree(t,
+		"a.txt",
+		"src/b.txt",
+		"src/c.go",
+		"vendor/d.txt",
+		"vendor/deep/h.txt",
+	)
+
+	tests := []struct {
+		args []string
+		want []string
+	}{
+		{
+			args: []string{"-include", "**"},
+			want: []string{"a.txt", "src/b.txt", "src/c.go", "vendor/d.txt", "vendor/deep/h.txt"},
+		},
+		{
+			// An excluded directory prunes everything inside it.
+			args: []string{"-include", "**", "-exclude", "vendor"},
+			want: []string{"a.txt", "src/b.txt", "src/c.go"},
+		},
+		{
+			args: []string{"-include", "**", "-exclude", "**/*.go"},
+			want: []string{"a.txt", "src/b.txt", "vendor/d.txt", "vendor/deep/h.txt"},
+		},
+		{
+			args: []string{"-include", "**/*.txt", "-exclude", "{src,vendor/deep}"},
+			want: []string{"a.txt", "vendor/d.txt"},
+		},
+	}
+
+	for _, test := range tests {
+		var stdout, stderr strings.Builder
+		if got := run(test.args, &stdout, &stderr); got != 0 {
+			t.Errorf("run(%q) = %d, want 0 (stderr: %s)", test.args, got, stderr.String())
+		}
+		got := strings.Fields(filepath.ToSlash(stdout.String()))
+		if diff := cmp.Diff(got, test.want); diff != "" {
+			t.Errorf("run(%q) output diff (-got +want):\n%s", test.args, diff)
+		}
+	}
+}
+
+func TestRun_BadPattern(t *testing.T) {
+	var stdout, stderr strings.Builder
+	if got := run([]string{"-include", "[a"}, &stdout, &stderr); got != 1 {
+		t.Errorf("run(-include [a) = %d, want 1", got)
+	}
+	if !strings.Contains(stderr.String(), "Couldn't parse pattern") {
+		t.Errorf("run(-include [a) stderr = %q, want parse error", stderr.String())
+	}
+}
@@ -0,0 +1,239 @@
+package zzglob
+
+import (
+	"slices"
+	"sync"
+	"sync/atomic"
+	"unicode/utf8"
+)
+
+// maxDFAStates limits the number of states cached by each lazy DFA. When the
+// limit is reached, the cache is flushed and rebuilt as needed.
+const maxDFAStates = 2048
+
+// program is a compact copy of the automaton, with states numbered (in
+// breadth-first order from the initial state) and nil-edge closures
+// precomputed.
+type program struct {
+	states []progState
+	start  []int32  // closure of the initial state
+	src    []*state // the original state for each id
+}
+
+// progState is a state within a program.
+type progState struct {
+	edges   []progEdge // only edges with non-nil Expr
+	closure []int32    // sorted ids reachable by nil edges (including itself)
+	accept  bool
+}
+
+// progEdge is an edge within a program.
+type progEdge struct {
+	expr expression
+	to   int32
+}
+
+// compile numbers the states of the automaton and computes the closures.
+func compile(initial *state) *program {
+	ids := map[*state]int32{initial: 0}
+	order := []*state{initial}
+	for i := 0; i < len(order); i++ {
+		for _, e := range order[i].Out {
+			if _, seen := ids[e.State]; !seen {
+				ids[e.State] = int32(len(order))
+				order = append(order, e.State)
+			}
+		}
+	}
+
+	prog := &program{states: make([]progState, len(order)), src: order}
+	for i, s := range order {
+		ps := &prog.states[i]
+		ps.accept = s.Accept
+		for _, e := range s.Out {
+			if e.Expr != nil {
+				ps.edges = append(ps.edges, progEdge{expr: e.Expr, to: ids[e.State]})
+			}
+		}
+
+		// Closure: everything reachable via nil edges.
+		set := singleton(s)
+		transitiveClosure(set)
+		for t := range set {
+			ps.closure = append(ps.closure, ids[t])
+		}
+		slices.Sort(ps.closure)
+	}
+	prog.start = prog.states[0].closure
+	return prog
+}
+
+// step returns the closed set of states reached from the closed set of states
+// by matching r. The result is sorted. seen is scratch space with one entry
+// per program state (all false on entry and exit).
+func (prog *program) step(set []int32, r rune, seen []bool) []int32 {
+	var next []int32
+	for _, id := range set {
+		for _, e := range prog.states[id].edges {
+			if !e.expr.match(r) {
+				continue
+			}
+			for _, c := range prog.states[e.to].closure {
+				if !seen[c] {
+					seen[c] = true
+					next = append(next, c)
+				}
+			}
+		}
+	}
+	for _, c := range next {
+		seen[c] = false
+	}
+	slices.Sort(next)
+	return next
+}
+
+// lazyDFA is a deterministic automaton built (and cached) on demand from a
+// program. It is safe for concurrent use. Once the states and transitions
+// needed to match a path are cached, matching the path again requires no
+// allocations.
+type lazyDFA struct {
+	prog  *program
+	limit int // maximum number of cached states
+
+	// start is the current initial DFA state. It is replaced when the cache
+	// is flushed.
+	start atomic.Pointer[dfaState]
+
+	// mu guards states and the non-ASCII transitions of every state.
+	mu     sync.RWMutex
+	states map[string]*dfaState
+}
+
+// dfaState is a state of a lazyDFA, corresponding to a set of program states.
+type dfaState struct {
+	set    []int32
+	key    string
+	accept bool
+
+	// Transitions on ASCII runes can be followed without locking.
+	ascii [utf8.RuneSelf]atomic.Pointer[dfaState]
+
+	// Transitions on other runes (guarded by lazyDFA.mu).
+	other map[rune]*dfaState
+}
+
+// newLazyDFA returns a new lazyDFA for the automaton.
+func newLazyDFA(initial *state) *lazyDFA {
+	return newLazyDFALimit(initial, maxDFAStates)
+}
+
+// newLazyDFALimit returns a new lazyDFA for the automaton, that caches at
+// most limit states.
+func newLazyDFALimit(initial *state, limit int) *lazyDFA {
+	d := &lazyDFA{
+		prog:   compile(initial),
+		limit:  limit,
+		states: make(map[string]*dfaState),
+	}
+	d.mu.Lock()
+	d.start.Store(d.lookup(d.prog.start))
+	d.mu.Unlock()
+	return d
+}
+
+// setKey encodes a sorted set of ids as a string, for use as a map key.
+func setKey(set []int32) string {
+	b := make([]byte, 0, 4*len(set))
+	for _, id := range set {
+		b = append(b, byte(id), byte(id>>8), byte(id>>16), byte(id>>24))
+	}
+	return string(b)
+}
+
+// lookup returns the cached DFA state for the set, or creates one. d.mu must
+// be held for writing.
+func (d *lazyDFA) lookup(set []int32) *dfaState {
+	key := setKey(set)
+	if ds := d.states[key]; ds != nil {
+		return ds
+	}
+	if len(d.states) >= d.limit {
+		// Flush the cache. Existing states remain valid (for any matches
+		// in progress), but will become unreachable from the new start.
+		clear(d.states)
+		start := &dfaState{set: d.prog.start, key: setKey(d.prog.start)}
+		start.accept = d.anyAccept(start.set)
+		d.states[start.key] = start
+		d.start.Store(start)
+		if start.key == key {
+			return start
+		}
+	}
+	ds := &dfaState{set: set, key: key, accept: d.anyAccept(set)}
+	d.states[key] = ds
+	return ds
+}
+
+// anyAccept reports whether any of the program states in set is accepting.
+func (d *lazyDFA) anyAccept(set []int32) bool {
+	for _, id := range set {
+		if d.prog.states[id].accept {
+			return true
+		}
+	}
+	return false
+}
+
+// next returns the DFA state reached from ds by matching r.
+func (d *lazyDFA) next(ds *dfaState, r rune) *dfaState {
+	if r < utf8.RuneSelf {
+		if n := ds.ascii[r].Load(); n != nil {
+			return n
+		}
+	} else {
+		d.mu.RLock()
+		n := ds.other[r]
+		d.mu.RUnlock()
+		if n != nil {
+			return n
+		}
+	}
+
+	// Not cached yet. Compute the transition.
+	seen := make([]bool, len(d.prog.states))
+	set := d.prog.step(ds.set, r, seen)
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	n := d.lookup(set)
+	if r < utf8.RuneSelf {
+		ds.ascii[r].Store(n)
+	} else {
+		if ds.other == nil {
+			ds.other = make(map[rune]*dfaState)
+		}
+		ds.other[r] = n
+	}
+	return n
+}
+
+// match reports whether the DFA accepts s.
+func (d *lazyDFA) match(s string) bool {
+	ds := d.final(s)
+	return ds != nil && ds.accept
+}
+
+// final returns the DFA state reached by matching s, or nil if no states are
+// reached.
+func (d *lazyDFA) final(s string) *dfaState {
+	ds := d.start.Load()
+	for _, r := range s {
+		ds = d.next(ds, r)
+		if len(ds.set) == 0 {
+			// Dead state - nothing further can match.
+			return nil
+		}
+	}
+	return ds
+}
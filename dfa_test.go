@@ -0,0 +1,144 @@
+package zzglob
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+)
+
+var dfaTestPatterns = []string{
+	"a/b*c/d?e/{f,g}/[ij]/**/[^k]l",
+	"**/*.go",
+	"{,a}{,a}{,a}{,a}{,a}b",
+	"x/[[:alpha:]\\p{Han}]*/[^[:digit:]]",
+	"src/**/{foo,bar}_test.go",
+	"*中*/**",
+}
+
+var dfaTestPaths = []string{
+	"",
+	"a",
+	"a/bxc/dye/f/i/l",
+	"a/bxc/dye/f/i/q/r/s/tl",
+	"a/bxc/dye/f/i/q/r/s/kl",
+	"main.go",
+	"cmd/zzglob/zzglob.go",
+	"aaab",
+	"aaaaaab",
+	"x/中文/x",
+	"x/abc/1",
+	"src/a/b/foo_test.go",
+	"src/bar_test.go",
+	"a中b/c/d",
+}
+
+// nfaMatch matches using the NFA directly, for comparison.
+func nfaMatch(p *Pattern, path string) bool {
+	rem, ok := p.cutRoot(path)
+	if !ok {
+		return false
+	}
+	for s := range matchSegment(singleton(p.initial), rem) {
+		if s.Accept {
+			return true
+		}
+	}
+	return false
+}
+
+func TestLazyDFA_MatchesNFA(t *testing.T) {
+	for _, pattern := range dfaTestPatterns {
+		p, err := Parse(pattern, WithSwapSlashes(false), AllowNamedCharClass(true))
+		if err != nil {
+			t.Fatalf("Parse(%q) error = %v", pattern, err)
+		}
+		for _, path := range dfaTestPaths {
+			// Twice, so the second time uses cached transitions.
+			for i := 0; i < 2; i++ {
+				if got, want := p.Match(path), nfaMatch(p, path); got != want {
+					t.Errorf("(%q).Match(%q) = %v, want %v", pattern, path, got, want)
+				}
+			}
+		}
+	}
+}
+
+func TestLazyDFA_CacheFlush(t *testing.T) {
+	p, err := Parse("**/{,a}{,a}{,a}{,a}b*/**", WithSwapSlashes(false))
+	if err != nil {
+		t.Fatalf("Parse error = %v", err)
+	}
+	d := newLazyDFALimit(p.initial, 3)
+	p.dfa = d
+
+	for _, path := range dfaTestPaths {
+		if got, want := p.Match(path), nfaMatch(p, path); got != want {
+			t.Errorf("Match(%q) = %v, want %v", path, got, want)
+		}
+	}
+	d.mu.RLock()
+	n := len(d.states)
+	d.mu.RUnlock()
+	if n > d.limit {
+		t.Errorf("len(d.states) = %d, want at most %d", n, d.limit)
+	}
+}
+
+func TestLazyDFA_NoAllocs(t *testing.T) {
+	p := MustParse("src/**/{foo,bar}_test.go")
+	path := "src/a/b/c/中/foo_test.go"
+	p.Match(path) // warm up the cache
+
+	if allocs := testing.AllocsPerRun(100, func() { p.Match(path) }); allocs != 0 {
+		t.Errorf("Match allocated %v times per run, want 0", allocs)
+	}
+}
+
+func TestLazyDFA_Concurrent(t *testing.T) {
+	p := MustParse("a/b*c/d?e/{f,g}/[ij]/**/[^k]l")
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 200; j++ {
+				path := fmt.Sprintf("a/b%dc/d%de/f/i/%s/l", i, j%10, strings.Repeat("x/", j%7))
+				if got, want := p.Match(path), nfaMatch(p, path); got != want {
+					t.Errorf("Match(%q) = %v, want %v", path, got, want)
+					return
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+}
+
+func BenchmarkMatch(b *testing.B) {
+	p := MustParse("src/**/{foo,bar}_test.go")
+	path := "src/github.com/DrJosh9000/zzglob/internal/foo_test.go"
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		p.Match(path)
+	}
+}
+
+func BenchmarkMatch_NFA(b *testing.B) {
+	p := MustParse("src/**/{foo,bar}_test.go")
+	path := "src/github.com/DrJosh9000/zzglob/internal/foo_test.go"
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		nfaMatch(p, path)
+	}
+}
+
+func BenchmarkMatch_Parallel(b *testing.B) {
+	p := MustParse("src/**/{foo,bar}_test.go")
+	path := "src/github.com/DrJosh9000/zzglob/internal/foo_test.go"
+	b.ReportAllocs()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			p.Match(path)
+		}
+	})
+}
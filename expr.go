@@ -1,11 +1,22 @@
 package zzglob
 
-import "slices"
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"unicode"
+)
 
 type expression interface {
 	// match reports if the rune matches the expression
 	match(rune) bool
 
+	// runeRanges returns the runes that match the expression, as sorted,
+	// non-overlapping ranges. It is consistent with match, but much slower,
+	// and is used for constructing new automata (e.g. by determinise).
+	runeRanges() []rangeExp
+
 	String() string
 }
 
@@ -27,14 +38,35 @@ type (
 	// ? matches like regexp [^/]
 	questionExp struct{}
 
+	// Character range expression
+	// [a-z] matches like regexp [a-z]
+	// Both lo and hi are inclusive.
+	rangeExp struct{ lo, hi rune }
+
+	// Named character class expression
+	// [[:alpha:]] matches like regexp [[:alpha:]] (but see posixClasses)
+	// [\p{Han}] matches like regexp \p{Han}
+	// [\P{Han}] matches like regexp \P{Han}
+	namedClassExp struct {
+		name    string // as written in the pattern, e.g. "[:alpha:]"
+		tables  []*unicode.RangeTable
+		negated bool
+		fold    bool // match case-insensitively
+	}
+
 	// Negated character class expression
 	// (Non-negated char classes are implemented like alternations: multiple
 	// out-edges from a state. Negating the negation in order to use the same
 	// representation won't work here: it would consist of a vast number of
 	// potentially matching runes.)
 	// [^...] matches like regexp [^...]
-	// The value of a negatedCCExp contains all the runes that do *not* match.
-	negatedCCExp []rune
+	// ranges contains all the ranges of runes that do *not* match, sorted and
+	// non-overlapping. Single runes are stored as ranges with lo == hi.
+	// Runes matching any of classes also do not match.
+	negatedCCExp struct {
+		ranges  []rangeExp
+		classes []namedClassExp
+	}
 
 	// The single-rune version of negatedCCExp
 	negatedLiteralExp rune
@@ -44,20 +76,306 @@ func (e literalExp) match(r rune) bool { return rune(e) == r }
 func (starExp) match(r rune) bool      { return r != '/' }
 func (doubleStarExp) match(rune) bool  { return true }
 func (questionExp) match(r rune) bool  { return r != '/' }
+func (e rangeExp) match(r rune) bool   { return e.lo <= r && r <= e.hi }
+
+func (e namedClassExp) match(r rune) bool {
+	in := unicode.IsOneOf(e.tables, r)
+	if e.fold {
+		// Try the other runes in the case-folding orbit of r.
+		for f := unicode.SimpleFold(r); !in && f != r; f = unicode.SimpleFold(f) {
+			in = unicode.IsOneOf(e.tables, f)
+		}
+	}
+	return in != e.negated
+}
 
 func (e negatedCCExp) match(r rune) bool {
-	// Unsubstantiated claim: negated classes usually contain few runes,
+	// Unsubstantiated claim: negated classes usually contain few ranges,
 	// so a linear search is probably acceptably fast, a binary search is
 	// probably very fast, and a map lookup might not be worth the work.
-	_, found := slices.BinarySearch(e, r)
-	return !found
+	if inRanges(e.ranges, r) {
+		return false
+	}
+	for _, c := range e.classes {
+		if c.match(r) {
+			return false
+		}
+	}
+	return true
 }
 
 func (e negatedLiteralExp) match(r rune) bool { return rune(e) != r }
 
-func (e literalExp) String() string        { return string(e) }
-func (starExp) String() string             { return "*" }
-func (doubleStarExp) String() string       { return "**" }
-func (questionExp) String() string         { return "?" }
-func (e negatedCCExp) String() string      { return "[^" + string(e) + "]" }
+func (e literalExp) runeRanges() []rangeExp  { return []rangeExp{{rune(e), rune(e)}} }
+func (starExp) runeRanges() []rangeExp       { return notSlashRanges }
+func (doubleStarExp) runeRanges() []rangeExp { return allRanges }
+func (questionExp) runeRanges() []rangeExp   { return notSlashRanges }
+func (e rangeExp) runeRanges() []rangeExp    { return []rangeExp{e} }
+
+func (e namedClassExp) runeRanges() []rangeExp {
+	var rs []rangeExp
+	for _, t := range e.tables {
+		rs = append(rs, tableRanges(t)...)
+	}
+	rs = mergeRanges(rs)
+	if e.fold {
+		rs = foldRanges(rs)
+	}
+	if e.negated {
+		return invertRanges(rs)
+	}
+	return rs
+}
+
+func (e negatedCCExp) runeRanges() []rangeExp {
+	rs := slices.Clone(e.ranges)
+	for _, c := range e.classes {
+		rs = append(rs, c.runeRanges()...)
+	}
+	return invertRanges(mergeRanges(rs))
+}
+
+func (e negatedLiteralExp) runeRanges() []rangeExp {
+	return invertRanges([]rangeExp{{rune(e), rune(e)}})
+}
+
+func (e literalExp) String() string  { return string(e) }
+func (starExp) String() string       { return "*" }
+func (doubleStarExp) String() string { return "**" }
+func (questionExp) String() string   { return "?" }
+func (e rangeExp) String() string    { return "[" + e.ccString() + "]" }
+func (e namedClassExp) String() string {
+	if e.fold {
+		return "(?i)[" + e.name + "]"
+	}
+	return "[" + e.name + "]"
+}
 func (e negatedLiteralExp) String() string { return "[^" + string(e) + "]" }
+
+func (e negatedCCExp) String() string {
+	var sb strings.Builder
+	sb.WriteString("[^")
+	for _, x := range e.ranges {
+		sb.WriteString(x.ccString())
+	}
+	for _, c := range e.classes {
+		sb.WriteString(c.name)
+	}
+	sb.WriteString("]")
+	return sb.String()
+}
+
+// exp simplifies the range into a literalExp if it contains only one rune.
+func (e rangeExp) exp() expression {
+	if e.lo == e.hi {
+		return literalExp(e.lo)
+	}
+	return e
+}
+
+// inRanges reports whether r is within any of rs, which must be sorted and
+// non-overlapping.
+func inRanges(rs []rangeExp, r rune) bool {
+	_, found := slices.BinarySearchFunc(rs, r, func(x rangeExp, r rune) int {
+		switch {
+		case x.hi < r:
+			return -1
+		case x.lo > r:
+			return 1
+		}
+		return 0
+	})
+	return found
+}
+
+// ccString writes the range the way it would appear inside a char class.
+func (e rangeExp) ccString() string {
+	if e.lo == e.hi {
+		return string(e.lo)
+	}
+	return string(e.lo) + "-" + string(e.hi)
+}
+
+var (
+	// allRanges contains every rune.
+	allRanges = []rangeExp{{0, unicode.MaxRune}}
+
+	// notSlashRanges contains every rune except /.
+	notSlashRanges = invertRanges([]rangeExp{{'/', '/'}})
+)
+
+// invertRanges returns the ranges of runes not in rs, which must be sorted
+// and non-overlapping.
+func invertRanges(rs []rangeExp) []rangeExp {
+	var out []rangeExp
+	next := rune(0)
+	for _, r := range rs {
+		if r.lo > next {
+			out = append(out, rangeExp{next, r.lo - 1})
+		}
+		next = r.hi + 1
+	}
+	if next <= unicode.MaxRune {
+		out = append(out, rangeExp{next, unicode.MaxRune})
+	}
+	return out
+}
+
+// foldRanges returns the runes in rs, together with every rune equivalent to
+// them under Unicode simple case folding, as sorted, non-overlapping ranges.
+// rs must be sorted and non-overlapping.
+func foldRanges(rs []rangeExp) []rangeExp {
+	out := slices.Clone(rs)
+	// Only foldable runes need their orbits added.
+	for _, fr := range foldableRanges() {
+		lo, hi := fr.lo, fr.hi
+		for _, r := range rs {
+			a, b := max(lo, r.lo), min(hi, r.hi)
+			for x := a; x <= b; x++ {
+				for f := unicode.SimpleFold(x); f != x; f = unicode.SimpleFold(f) {
+					out = append(out, rangeExp{f, f})
+				}
+			}
+		}
+	}
+	return mergeRanges(out)
+}
+
+// foldableRanges returns the ranges of runes that are equivalent to some other
+// rune under simple case folding. This is a superset of unicode.CaseRanges
+// (e.g. it includes 'ß', which folds with 'ẞ').
+var foldableRanges = sync.OnceValue(func() []rangeExp {
+	var rs []rangeExp
+	for r := rune(0); r <= unicode.MaxRune; r++ {
+		if unicode.SimpleFold(r) == r {
+			continue
+		}
+		if n := len(rs); n > 0 && rs[n-1].hi == r-1 {
+			rs[n-1].hi = r
+			continue
+		}
+		rs = append(rs, rangeExp{r, r})
+	}
+	return rs
+})
+
+// tableRanges converts a Unicode range table into ranges (unsorted).
+func tableRanges(t *unicode.RangeTable) []rangeExp {
+	var rs []rangeExp
+	add := func(lo, hi, stride rune) {
+		if stride == 1 {
+			rs = append(rs, rangeExp{lo, hi})
+			return
+		}
+		for r := lo; r <= hi; r += stride {
+			rs = append(rs, rangeExp{r, r})
+		}
+	}
+	for _, r := range t.R16 {
+		add(rune(r.Lo), rune(r.Hi), rune(r.Stride))
+	}
+	for _, r := range t.R32 {
+		add(rune(r.Lo), rune(r.Hi), rune(r.Stride))
+	}
+	return rs
+}
+
+// mergeRanges sorts the ranges, and merges any that overlap or are adjacent.
+func mergeRanges(rs []rangeExp) []rangeExp {
+	if len(rs) == 0 {
+		return rs
+	}
+	slices.SortFunc(rs, func(a, b rangeExp) int { return int(a.lo - b.lo) })
+	out := rs[:1]
+	for _, r := range rs[1:] {
+		last := &out[len(out)-1]
+		if r.lo <= last.hi+1 {
+			last.hi = max(last.hi, r.hi)
+			continue
+		}
+		out = append(out, r)
+	}
+	return out
+}
+
+// Tables for the POSIX classes that the unicode package doesn't provide.
+var (
+	asciiDigitTable = &unicode.RangeTable{
+		R16:         []unicode.Range16{{Lo: '0', Hi: '9', Stride: 1}},
+		LatinOffset: 1,
+	}
+	asciiHexDigitTable = &unicode.RangeTable{
+		R16: []unicode.Range16{
+			{Lo: '0', Hi: '9', Stride: 1},
+			{Lo: 'A', Hi: 'F', Stride: 1},
+			{Lo: 'a', Hi: 'f', Stride: 1},
+		},
+		LatinOffset: 3,
+	}
+	blankTable = &unicode.RangeTable{
+		R16: []unicode.Range16{
+			{Lo: '\t', Hi: '\t', Stride: 1},
+			{Lo: ' ', Hi: ' ', Stride: 1},
+		},
+		LatinOffset: 2,
+	}
+	asciiSpaceTable = &unicode.RangeTable{
+		R16:         []unicode.Range16{{Lo: ' ', Hi: ' ', Stride: 1}},
+		LatinOffset: 1,
+	}
+)
+
+// posixClasses maps POSIX class names to equivalent Unicode tables. Like
+// shells in UTF-8 locales (and unlike package regexp), most classes match
+// non-ASCII runes. [:digit:] and [:xdigit:] are the exception, following
+// POSIX.
+var posixClasses = map[string][]*unicode.RangeTable{
+	"alnum":  {unicode.L, asciiDigitTable},
+	"alpha":  {unicode.L},
+	"blank":  {blankTable},
+	"cntrl":  {unicode.Cc},
+	"digit":  {asciiDigitTable},
+	"graph":  {unicode.L, unicode.M, unicode.N, unicode.P, unicode.S},
+	"lower":  {unicode.Lower},
+	"print":  {unicode.L, unicode.M, unicode.N, unicode.P, unicode.S, asciiSpaceTable},
+	"punct":  {unicode.P, unicode.S},
+	"space":  {unicode.White_Space},
+	"upper":  {unicode.Upper},
+	"xdigit": {asciiHexDigitTable},
+}
+
+// posixClass returns an expression for the named POSIX class.
+func posixClass(name string) (namedClassExp, error) {
+	tables := posixClasses[name]
+	if tables == nil {
+		return namedClassExp{}, fmt.Errorf("unknown POSIX class [:%s:]", name)
+	}
+	return namedClassExp{
+		name:   "[:" + name + ":]",
+		tables: tables,
+	}, nil
+}
+
+// unicodeClass returns an expression for the named Unicode category, script,
+// or property.
+func unicodeClass(name string, negated bool) (namedClassExp, error) {
+	table := unicode.Categories[name]
+	if table == nil {
+		table = unicode.Scripts[name]
+	}
+	if table == nil {
+		table = unicode.Properties[name]
+	}
+	p := `\p`
+	if negated {
+		p = `\P`
+	}
+	if table == nil {
+		return namedClassExp{}, fmt.Errorf("unknown Unicode class %s{%s}", p, name)
+	}
+	return namedClassExp{
+		name:    p + "{" + name + "}",
+		tables:  []*unicode.RangeTable{table},
+		negated: negated,
+	}, nil
+}
@@ -2,18 +2,22 @@
 package zzglob // import "drjosh.dev/zzglob"
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"io/fs"
 	"os"
 	"path"
 	"path/filepath"
+	"slices"
 	"strings"
 )
 
 const globSymlinkRecursionLimit = 1000
 
-// Glob globs for files matching the pattern in a filesystem.
+// Glob globs for files matching the pattern in a filesystem. If the pattern
+// only matches a few specific paths (see Paths), each is stat-ed instead of
+// walking the root.
 func (p *Pattern) Glob(f fs.WalkDirFunc, opts ...GlobOption) error {
 	if f == nil {
 		return errors.New("nil WalkDirFunc in arg to Glob")
@@ -31,8 +35,139 @@ func (p *Pattern) Glob(f fs.WalkDirFunc, opts ...GlobOption) error {
 		o(cfg)
 	}
 
-	// p.root always uses forward slashes. Translate (if needed)?
+	// Stat each path if there are few enough, rather than walking.
+	if paths, ok := p.globPaths(cfg); ok {
+		return statPaths(cfg.context(), cfg, paths)
+	}
+
+	cfg.watchSkipAll()
+	for _, st := range p.globStarts(cfg) {
+		if err := p.globRoot(cfg, st); err != nil {
+			return err
+		}
+		if cfg.skippedAll.Load() {
+			return nil
+		}
+	}
+	return nil
+}
+
+// globRoots returns the cleaned roots to glob from. Usually this is only the
+// pattern root, but if the pattern is case-insensitive then it is every
+// existing path that matches the root.
+func (p *Pattern) globRoots(cfg *globConfig) []string {
 	cleanRoot := path.Clean(p.root)
+	if !p.inputConfig.caseInsensitive {
+		return []string{cleanRoot}
+	}
+	return resolveFold(cleanRoot, cfg.readDir)
+}
+
+// maxGlobPaths is the most paths that Glob will stat for a finite pattern,
+// rather than walking from the root.
+const maxGlobPaths = 1024
+
+// globPaths returns the paths matched by the pattern, to be stat-ed instead
+// of walking, if the pattern is finite (see Paths). Paths that walking would
+// never produce (e.g. a/./b, or the root itself) are left out, and the rest
+// are in the order that walking would find them.
+func (p *Pattern) globPaths(cfg *globConfig) ([]string, bool) {
+	if p.initial == nil || cfg.walkIntermediateDirs || !cfg.traverseSymlinks {
+		return nil, false
+	}
+	paths, ok := p.paths(maxGlobPaths)
+	if !ok {
+		return nil, false
+	}
+	out := paths[:0]
+	for _, fp := range paths {
+		if isWalkable(strings.TrimSuffix(strings.TrimPrefix(fp, p.root), "/")) {
+			out = append(out, fp)
+		}
+	}
+	slices.SortFunc(out, compareWalkOrder)
+	return out, true
+}
+
+// statPaths passes each of the paths that exists to the callback. A path with
+// a trailing slash only matches a directory, and one without only matches a
+// non-directory, as when walking. The paths should be in walk order (see
+// compareWalkOrder). As when walking, if the callback returns fs.SkipDir for
+// a directory, the paths within it are skipped, and for a non-directory, the
+// rest of the paths in the same directory are skipped.
+func statPaths(ctx context.Context, cfg *globConfig, paths []string) error {
+	skip := "" // skip paths with this prefix
+	for _, fp := range paths {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		name := path.Clean(fp)
+		if skip != "" && strings.HasPrefix(name, skip) {
+			continue
+		}
+		osName := name
+		if cfg.translateSlashes {
+			osName = filepath.FromSlash(name)
+		}
+
+		var fi fs.FileInfo
+		var err error
+		if cfg.filesystem == nil {
+			fi, err = os.Stat(osName)
+		} else {
+			fi, err = fs.Stat(cfg.filesystem, name)
+		}
+		if err != nil && !errors.Is(err, fs.ErrPermission) {
+			// Doesn't exist (or a parent isn't a directory), so walking
+			// wouldn't have found it.
+			continue
+		}
+		if err == nil && fi.IsDir() != strings.HasSuffix(fp, "/") {
+			continue
+		}
+		if err := cfg.callback(osName, fs.FileInfoToDirEntry(fi), err); err != nil {
+			if errors.Is(err, fs.SkipAll) {
+				return nil
+			}
+			if errors.Is(err, fs.SkipDir) {
+				dir := name
+				if fi == nil || !fi.IsDir() {
+					dir = path.Dir(name)
+				}
+				if dir == "." {
+					// The rest are all in the same directory.
+					return nil
+				}
+				skip = strings.TrimSuffix(dir, "/") + "/"
+				continue
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+// globStarts returns the directories to start walking from, and the states
+// to start each walk with. Usually there is one for each of globRoots, but
+// leading literal directories are split up (see splitRoot).
+func (p *Pattern) globStarts(cfg *globConfig) []globStart {
+	var starts []globStart
+	for _, root := range p.globRoots(cfg) {
+		if p.initial == nil {
+			starts = append(starts, globStart{root: root})
+			continue
+		}
+		starts = append(starts, splitRoot(cfg, root, singleton(p.initial))...)
+	}
+	return starts
+}
+
+// globRoot globs starting at one root.
+func (p *Pattern) globRoot(cfg *globConfig, st globStart) error {
+	f := cfg.callback
+	cleanRoot := st.root
+
+	// p.root always uses forward slashes. Translate (if needed)?
 	osRoot := cleanRoot
 	if cfg.translateSlashes {
 		osRoot = filepath.FromSlash(cleanRoot)
@@ -42,6 +177,10 @@ func (p *Pattern) Glob(f fs.WalkDirFunc, opts ...GlobOption) error {
 		if cfg.filesystem == nil {
 			// The fastest way to stat the file is... to stat the file.
 			fi, err := os.Stat(osRoot)
+			if err == nil && !fi.IsDir() && strings.HasSuffix(p.root, "/") {
+				// The pattern ends with /, so only matches a directory.
+				return nil
+			}
 			if err := f(osRoot, fs.FileInfoToDirEntry(fi), err); err != nil {
 				if errors.Is(err, fs.SkipDir) || errors.Is(err, fs.SkipAll) {
 					return nil
@@ -51,6 +190,10 @@ func (p *Pattern) Glob(f fs.WalkDirFunc, opts ...GlobOption) error {
 		} else {
 			// Assume root sits at that path within the provided fs.FS.
 			fi, err := fs.Stat(cfg.filesystem, cleanRoot)
+			if err == nil && !fi.IsDir() && strings.HasSuffix(p.root, "/") {
+				// The pattern ends with /, so only matches a directory.
+				return nil
+			}
 			if err := f(osRoot, fs.FileInfoToDirEntry(fi), err); err != nil {
 				if errors.Is(err, fs.SkipDir) || errors.Is(err, fs.SkipAll) {
 					return nil
@@ -61,11 +204,23 @@ func (p *Pattern) Glob(f fs.WalkDirFunc, opts ...GlobOption) error {
 		return nil
 	}
 
+	return globFrom(cfg, cleanRoot, st.states, nil)
+}
+
+// globFrom walks the directory cleanRoot, matching paths within it starting
+// from the given states. decide is optional (see globState).
+func globFrom(cfg *globConfig, cleanRoot string, states stateSet, decide func(stateSet) (bool, bool)) error {
+	osRoot := cleanRoot
+	if cfg.translateSlashes {
+		osRoot = filepath.FromSlash(cleanRoot)
+	}
+
 	gs := globState{
 		cfg:    cfg,
 		root:   cleanRoot,
 		fs:     cfg.filesystem,
-		states: singleton(p.initial),
+		states: states,
+		decide: decide,
 	}
 
 	// Filesystem override?
@@ -82,7 +237,61 @@ func (p *Pattern) Glob(f fs.WalkDirFunc, opts ...GlobOption) error {
 	}
 
 	gs.logf("starting walk in fsys %v, root %q at . with %d states\n", gs.fs, gs.root, len(gs.states))
-	return fs.WalkDir(gs.fs, ".", gs.walkDirFunc)
+	if cfg.parallelism > 1 {
+		return gs.walkParallel(cfg.context())
+	}
+	return gs.walk(gs.walkDirFunc)
+}
+
+// resolveFold returns the existing paths that match root, comparing each
+// path component case-insensitively (using Unicode simple case folding).
+// This is needed because the root is opened directly (e.g. with os.DirFS),
+// which is case-sensitive on most systems. root must be clean, and use
+// forward slashes. Components that can't be resolved (e.g. because they don't
+// exist) are kept as they are, so that the error is reported when globbing.
+func resolveFold(root string, readDir func(string) ([]fs.DirEntry, error)) []string {
+	// Keep any volume name and leading slashes as they are.
+	vol := filepath.VolumeName(root)
+	rest := strings.TrimLeft(root[len(vol):], "/")
+	prefix := root[:len(root)-len(rest)]
+	if rest == "." {
+		return []string{root}
+	}
+
+	join := func(dir, name string) string {
+		if dir == "" || strings.HasSuffix(dir, "/") {
+			return dir + name
+		}
+		return dir + "/" + name
+	}
+
+	paths := []string{prefix}
+	for _, comp := range strings.Split(rest, "/") {
+		var next []string
+		for _, dir := range paths {
+			if comp == ".." {
+				next = append(next, join(dir, comp))
+				continue
+			}
+			readPath := dir
+			if readPath == "" {
+				readPath = "."
+			}
+			entries, err := readDir(readPath)
+			found := false
+			for _, de := range entries {
+				if strings.EqualFold(de.Name(), comp) {
+					next = append(next, join(dir, de.Name()))
+					found = true
+				}
+			}
+			if err != nil || !found {
+				next = append(next, join(dir, comp))
+			}
+		}
+		paths = next
+	}
+	return paths
 }
 
 type globState struct {
@@ -91,10 +300,66 @@ type globState struct {
 	root   string
 	fs     fs.FS
 	states stateSet
+
+	// dirs is the stack of directories currently being walked, together
+	// with the states reached after matching each of them (including the
+	// trailing /). Since fs.WalkDir walks depth-first, each entry can be
+	// matched by advancing from its parent directory's states by only its
+	// basename.
+	dirs []dirStates
+
+	// decide, if not nil, replaces the default rule for deciding whether the
+	// states accept, or could accept something within a directory (see
+	// judge).
+	decide func(stateSet) (accept, descend bool)
+}
+
+// dirStates associates a directory with the states reached by matching it.
+type dirStates struct {
+	dir    string
+	states stateSet
+}
+
+// parentStates returns the states reached by matching the parent directory
+// of fp (relative to the walk root), popping any directories that have
+// finished being walked.
+func (gs *globState) parentStates(fp string) stateSet {
+	if len(gs.dirs) == 0 {
+		gs.dirs = append(gs.dirs, dirStates{dir: ".", states: gs.states})
+	}
+	parent := path.Dir(fp)
+	for len(gs.dirs) > 1 && gs.dirs[len(gs.dirs)-1].dir != parent {
+		gs.dirs = gs.dirs[:len(gs.dirs)-1]
+	}
+	if top := gs.dirs[len(gs.dirs)-1]; top.dir == parent {
+		return top.states
+	}
+	// Shouldn't happen (the parent should have been walked first), but if it
+	// does, fall back to matching the whole path.
+	return matchSegment(gs.states, parent+"/")
+}
+
+// judge reports whether the states accept the path, and whether anything
+// within the path (if it is a directory) could be accepted.
+func (gs *globState) judge(states stateSet) (accept, descend bool) {
+	if gs.decide != nil {
+		return gs.decide(states)
+	}
+	for s := range states {
+		if s.Accept {
+			accept = true
+		}
+		if len(s.Out) > 0 {
+			descend = true
+		}
+	}
+	return accept, descend
 }
 
 func (gs *globState) logf(f string, v ...any) {
 	if gs.cfg.traceLogger != nil {
+		gs.cfg.logMu.Lock()
+		defer gs.cfg.logMu.Unlock()
 		fmt.Fprintf(gs.cfg.traceLogger, f, v...)
 	}
 }
@@ -107,59 +372,149 @@ func (gs *globState) walkDirFunc(fp string, d fs.DirEntry, err error) error {
 	}
 
 	if fp == "." {
-		// Assumed invariant: the recursion always walks starting in a directory.
-		// This requires ensuring we don't recurse on symlinks to non-directories.
-		gs.logf("fast path for .\n")
-		if gs.cfg.walkIntermediateDirs {
-			full := gs.root
-			if gs.cfg.translateSlashes {
-				full = filepath.FromSlash(full)
-			}
-			return gs.cfg.callback(full, d, err)
+		return gs.walkRoot(d, err)
+	}
+
+	v := gs.plan(fp, d, err, gs.parentStates(fp))
+	if d != nil && d.IsDir() && len(v.states) > 0 {
+		// The walk may descend into this directory next.
+		gs.dirs = append(gs.dirs, dirStates{dir: fp, states: v.states})
+	}
+	if err := gs.report(v); err != nil {
+		return err
+	}
+	if v.outcome == outcomeLink {
+		gs.logf("starting symlink walk in fsys %v, root %q at . with %d states\n", v.link.fs, v.link.root, len(v.link.states))
+		return v.link.walk(v.link.walkDirFunc)
+	}
+	return v.result()
+}
+
+// walkRoot handles the root of the walk (.), which is only passed to the
+// callback if walkIntermediateDirs is enabled.
+func (gs *globState) walkRoot(d fs.DirEntry, err error) error {
+	// Assumed invariant: the recursion always walks starting in a directory.
+	// This requires ensuring we don't recurse on symlinks to non-directories.
+	gs.logf("fast path for .\n")
+	if gs.cfg.walkIntermediateDirs {
+		full := gs.root
+		if gs.cfg.translateSlashes {
+			full = filepath.FromSlash(full)
 		}
-		return nil
+		return gs.cfg.callback(full, d, err)
 	}
+	return nil
+}
 
-	// Directories have a trailing slash for matching.
-	// (Symlinks to other directories won't get a slash here.)
+// planOutcome is what happens after a path has (if needed) been passed to
+// the callback, and the callback returned nil.
+type planOutcome int
 
-	// Rage (match fp) against the (state) machine.
-	states := matchSegment(gs.states, fp)
+const (
+	outcomeContinue planOutcome = iota // carry on (into the directory, if it is one)
+	outcomeSkipDir                     // don't walk within the directory
+	outcomeReport                      // pass the path to the callback again, with outcomeErr
+	outcomeLink                        // walk the symlinked directory
+)
 
-	// If it's a directory the pattern should match another /
-	if d != nil && d.IsDir() && !strings.HasSuffix(fp, "/") {
-		states = matchSegment(states, "/")
+// walkPlan is the plan for a single walked path, made by plan.
+type walkPlan struct {
+	states stateSet // reached by matching the path
+
+	// If report is set, call the callback with cbPath, d, and cbErr first.
+	report bool
+	cbPath string
+	d      fs.DirEntry
+	cbErr  error
+
+	outcome    planOutcome
+	outcomeErr error      // for outcomeReport
+	link       *globState // for outcomeLink
+}
+
+// result returns the error to give the walker for outcomes other than
+// outcomeReport and outcomeLink.
+func (v *walkPlan) result() error {
+	if v.outcome == outcomeSkipDir {
+		return fs.SkipDir
 	}
+	return nil
+}
 
-	gs.logf("matchSegment(%d states, %q) -> %d states\n", len(gs.states), fp, len(states))
+// report calls the callback, if the plan says to. For outcomeReport, the
+// second call is made too, and its error returned.
+func (gs *globState) report(v *walkPlan) error {
+	if v.report {
+		if err := gs.cfg.callback(v.cbPath, v.d, v.cbErr); err != nil {
+			return err
+		}
+	}
+	if v.outcome == outcomeReport {
+		return gs.cfg.callback(v.cbPath, v.d, v.outcomeErr)
+	}
+	return nil
+}
 
-	accept := false
-	for s := range states {
-		if s.Accept {
-			accept = true
-			gs.logf("\t(at least one accept state)\n")
-			break
+// plan decides what to do with the path fp (other than .) found while
+// walking, given the states reached by matching its parent directory. It
+// doesn't call the callback or change gs, so it is safe to call concurrently.
+func (gs *globState) plan(fp string, d fs.DirEntry, err error, parent stateSet) *walkPlan {
+	// Rage (match the basename of fp) against the (state) machine, starting
+	// from the states for the parent directory.
+	states := matchSegment(parent, path.Base(fp))
+
+	// Directories have a trailing slash for matching. This includes symlinks
+	// to directories, but finding out requires a stat, so only do that if it
+	// could matter: either the symlink could be traversed, or a / could be
+	// matched next.
+	isDir := d != nil && d.IsDir()
+	isSymlink := d != nil && d.Type()&fs.ModeSymlink != 0
+	var statErr error
+	if isSymlink && err == nil && len(states) > 0 &&
+		(gs.cfg.traverseSymlinks || len(matchSegment(states, "/")) > 0) {
+		// (It looks like fs.Sub doesn't check for this?)
+		fi, err := fs.Stat(gs.fs, fp)
+		if err != nil {
+			statErr = err
+		} else {
+			isDir = fi.IsDir()
 		}
 	}
+	if isDir && !strings.HasSuffix(fp, "/") {
+		states = matchSegment(states, "/")
+	}
+	v := &walkPlan{states: states, d: d}
+
+	gs.logf("matchSegment(parent states, %q) -> %d states\n", path.Base(fp), len(states))
+
+	accept, descend := gs.judge(states)
+	if accept {
+		gs.logf("\t(at least one accept state)\n")
+	}
 
 	// Did it match in any way?
 	if len(states) == 0 {
 		if d != nil && d.IsDir() {
 			// Skip - not interested in anything in this directory.
 			gs.logf("directory didn't match at all; returning fs.SkipDir\n")
-			return fs.SkipDir
+			v.outcome = outcomeSkipDir
+			return v
 		}
 
 		// This non-directory thing doesn't match. Don't return
 		// [fs.SkipDir], since that skips the remainder of the directory.
 		gs.logf("non-directory didn't match at all; skipping\n")
-		return nil
+		return v
 	}
 
 	// The path is either a partial or full match from this point.
 
 	full := path.Join(gs.root, fp)
 	gs.logf("full = %q\n", full)
+	v.cbPath = full
+	if gs.cfg.translateSlashes {
+		v.cbPath = filepath.FromSlash(full)
+	}
 
 	// If the pattern fully matched, or this is a directory (that partially
 	// matched) and either walkIntermediateDirs is enabled or an error needs
@@ -173,25 +528,32 @@ func (gs *globState) walkDirFunc(fp string, d fs.DirEntry, err error) error {
 		case gs.cfg.walkIntermediateDirs:
 			gs.logf("partial match of intermediate dir, with walkIntermediateDirs! passing to callback\n")
 		}
-		cbPath := full
-		if gs.cfg.translateSlashes {
-			cbPath = filepath.FromSlash(cbPath)
-		}
-		if err := gs.cfg.callback(cbPath, d, err); err != nil {
-			return err
-		}
+		v.report = true
+		v.cbErr = err
 		// If accepted and it's a symlink, fall through to symlink traversal
 		// rather than returning, so the walker descends into it.
 		if !accept {
-			return nil
+			return v
 		}
 	}
 
+	// If the pattern can't match anything within this directory (e.g. it
+	// ends with a / that has just been matched), then don't descend.
+	if isDir && !descend {
+		if d.IsDir() {
+			gs.logf("pattern can't match within directory; returning fs.SkipDir\n")
+			v.outcome = outcomeSkipDir
+			return v
+		}
+		gs.logf("pattern can't match within directory symlink; skipping\n")
+		return v
+	}
+
 	// If there was an error walking this path and we didn't call the callback
 	// above, we won't try to complete the match.
 	if err != nil {
 		gs.logf("error at partial match: %v - skipping\n", err)
-		return nil
+		return v
 	}
 
 	// The pattern matched only partially...
@@ -199,60 +561,53 @@ func (gs *globState) walkDirFunc(fp string, d fs.DirEntry, err error) error {
 	if !gs.cfg.traverseSymlinks {
 		// Nope - just keep walking.
 		gs.logf("symlink traversal disabled; skipping\n")
-		return nil
+		return v
 	}
 
 	// It's all symlink handling from this point.
-	if d == nil || d.Type()&fs.ModeSymlink == 0 {
+	if !isSymlink {
 		// Not a symlink.
 		gs.logf("not a symlink; skipping\n")
-		return nil
+		return v
 	}
 
-	// Is it a symlink to a directory?
-	// (It looks like fs.Sub doesn't check for this?)
-	fi, err := fs.Stat(gs.fs, fp)
-	if err != nil {
+	if statErr != nil {
 		// We can't stat it, so we don't know if it's a directory or not, so
 		// it needs reporting to the callback whether or not walkIntermediateDirs
 		// is enabled.
-		gs.logf("fs.Stat symlink error: %v - passing to callback\n", err)
-		if gs.cfg.translateSlashes {
-			full = filepath.FromSlash(full)
-		}
-		return gs.cfg.callback(full, d, err)
+		gs.logf("fs.Stat symlink error: %v - passing to callback\n", statErr)
+		v.outcome, v.outcomeErr = outcomeReport, statErr
+		return v
 	}
 
-	if !fi.IsDir() {
+	// Because we only traverse symlinks to directories, the pattern has
+	// already matched another /.
+	if !isDir {
 		gs.logf("not a directory symlink; skipping\n")
-		return nil
-	}
-
-	// Because we only traverse symlinks to directories, the pattern must match
-	// another /.
-	states = matchSegment(states, "/")
-	if len(states) == 0 {
-		gs.logf("pattern did not match additional /; skipping\n")
-		return nil
+		return v
 	}
 
 	subfs, err := fs.Sub(gs.fs, fp)
 	if err != nil {
 		gs.logf("error from fs.Sub(gs.fsys, %q): %v - passing to callback\n", fp, err)
-		return gs.cfg.callback(fp, d, err)
+		v.outcome, v.outcomeErr = outcomeReport, err
+		v.cbPath = fp
+		return v
 	}
 
-	// Walk the symlink by... recursion.
+	// Walk the symlink by... recursion. The sub-walk carries on from the
+	// states already reached for the symlink (including the /), so nothing
+	// is matched again.
 	// [fs.WalkDir] doesn't walk symlinks unless it is the root path... in
 	// which case it does!
-	next := globState{
+	v.outcome = outcomeLink
+	v.link = &globState{
 		depth:  gs.depth + 1,
 		cfg:    gs.cfg,
 		root:   full,
 		fs:     subfs,
 		states: states,
+		decide: gs.decide,
 	}
-
-	gs.logf("starting symlink walk in fsys %v, root %q at . with %d states\n", subfs, next.root, len(gs.states))
-	return fs.WalkDir(subfs, ".", next.walkDirFunc)
+	return v
 }
@@ -1,14 +1,18 @@
 package zzglob
 
 import (
+	"fmt"
 	"io/fs"
 	"os"
+	"path"
 	"path/filepath"
+	"slices"
 	"sort"
 	"strings"
 	"sync"
 	"syscall"
 	"testing"
+	"testing/fstest"
 
 	"github.com/google/go-cmp/cmp"
 )
@@ -36,8 +40,11 @@ func (c *walkFuncCalls) sortCalls() {
 	c.mu.Lock()
 	defer c.mu.Unlock()
 	sort.Slice(c.calls, func(i, j int) bool {
-		// Only sort path for now
-		return c.calls[i].Path < c.calls[j].Path
+		// Only sort path for now (calls without errors first, for ties)
+		if c.calls[i].Path != c.calls[j].Path {
+			return c.calls[i].Path < c.calls[j].Path
+		}
+		return c.calls[i].Err == nil && c.calls[j].Err != nil
 	})
 }
 
@@ -260,6 +267,64 @@ func TestGlob_TraverseSymlinksDisabled(t *testing.T) {
 	}
 }
 
+// openRecorder records the names opened from the filesystem (as fs.Stat does
+// for a subtree).
+type openRecorder struct {
+	fs.FS
+	opens []string
+}
+
+func (r *openRecorder) Open(name string) (fs.File, error) {
+	r.opens = append(r.opens, name)
+	return r.FS.Open(name)
+}
+
+func TestGlob_TraverseSymlinksDisabledStats(t *testing.T) {
+	tests := []struct {
+		pattern  string
+		want     []walkFuncArgs
+		wantStat bool
+	}{
+		{
+			// link.txt can't be a match as a directory, so there's no need
+			// to find out if it is one.
+			pattern: "a/*.txt",
+			want: []walkFuncArgs{
+				{Path: "a/link.txt"},
+				{Path: "a/x.txt"},
+			},
+		},
+		{
+			pattern: "a/*/",
+			want: []walkFuncArgs{
+				{Path: "a/link.txt"},
+				{Path: "a/real"},
+			},
+			wantStat: true,
+		},
+	}
+
+	for _, test := range tests {
+		fsys := &openRecorder{
+			FS: fstest.MapFS{
+				"a/link.txt": {Mode: fs.ModeSymlink, Data: []byte("real")},
+				"a/real/y":   {},
+				"a/x.txt":    {},
+			},
+		}
+		var got walkFuncCalls
+		if err := MustParse(test.pattern).Glob(got.walkFunc, traceLogOpt, WithFilesystem(fsys), TraverseSymlinks(false)); err != nil {
+			t.Fatalf("Glob(%q) = %v", test.pattern, err)
+		}
+		if diff := cmp.Diff(got.calls, test.want); diff != "" {
+			t.Errorf("%q walked paths diff (-got +want):\n%s", test.pattern, diff)
+		}
+		if got := slices.Contains(fsys.opens, "a/link.txt"); got != test.wantStat {
+			t.Errorf("%q stat-ed a/link.txt = %t, want %t", test.pattern, got, test.wantStat)
+		}
+	}
+}
+
 func TestGlob_Absolute(t *testing.T) {
 	src := "fixtures/a/b/c*d/e?f/[ghi]/{j,k,l}/**/m"
 	pattern, err := filepath.Abs(filepath.FromSlash(src))
@@ -445,3 +510,482 @@ func TestGlob_SpecificPath_WithFilesystem(t *testing.T) {
 		t.Errorf("walked paths diff (-got +want):\n%s", diff)
 	}
 }
+
+func TestGlob_ExtGlob(t *testing.T) {
+	pattern := "fixtures/spec/!(*_spec|*_test).*"
+	p, err := Parse(pattern, AllowExtGlob(true))
+	if err != nil {
+		t.Fatalf("Parse(%q) = %v", pattern, err)
+	}
+
+	var got walkFuncCalls
+	if err := p.Glob(got.walkFunc, traceLogOpt); err != nil {
+		t.Fatalf("Glob(...) = %v", err)
+	}
+
+	want := walkFuncCalls{
+		calls: []walkFuncArgs{
+			{
+				// borked partially matches, and is a broken symlink.
+				Path: "fixtures/spec/borked",
+				Err:  &fs.PathError{Op: "stat", Path: "borked", Err: syscall.ENOENT},
+			},
+			{Path: "fixtures/spec/my_tests.py"},
+			{Path: "fixtures/spec/snake.txt"},
+		},
+	}
+
+	if diff := cmp.Diff(got.calls, want.calls); diff != "" {
+		t.Errorf("walked paths diff (-got +want):\n%s", diff)
+	}
+}
+
+func TestGlob_NumericRange(t *testing.T) {
+	fsys := fstest.MapFS{
+		"render/frame7.png":         {},
+		"render/frame007.png":       {},
+		"render/frame299.png":       {},
+		"render/frame300.png":       {},
+		"render/frame.png":          {},
+		"logs/5/app.log":            {},
+		"logs/12/app.log":           {},
+		"logs/4/app.log":            {},
+		"logs/x/app.log":            {},
+		"logs/5/nested/app.log":     {},
+		"logs/0005/app.log":         {},
+		"logs/123456789012/app.log": {},
+	}
+
+	tests := []struct {
+		pattern string
+		want    []walkFuncArgs
+	}{
+		{
+			pattern: "render/frame<0-299>.png",
+			want: []walkFuncArgs{
+				{Path: "render/frame007.png"},
+				{Path: "render/frame299.png"},
+				{Path: "render/frame7.png"},
+			},
+		},
+		{
+			pattern: "logs/<5->/*.log",
+			want: []walkFuncArgs{
+				{Path: "logs/0005/app.log"},
+				{Path: "logs/12/app.log"},
+				{Path: "logs/123456789012/app.log"},
+				{Path: "logs/5/app.log"},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		p, err := Parse(test.pattern, AllowNumericRange(true))
+		if err != nil {
+			t.Fatalf("Parse(%q) = %v", test.pattern, err)
+		}
+
+		var got walkFuncCalls
+		if err := p.Glob(got.walkFunc, traceLogOpt, WithFilesystem(fsys)); err != nil {
+			t.Fatalf("Glob(...) = %v", err)
+		}
+
+		if diff := cmp.Diff(got.calls, test.want); diff != "" {
+			t.Errorf("%q walked paths diff (-got +want):\n%s", test.pattern, diff)
+		}
+	}
+}
+
+func TestGlob_CaseInsensitive(t *testing.T) {
+	fsys := fstest.MapFS{
+		"Photos/2024/IMG_0001.jpg": {},
+		"Photos/2024/img_0002.JPG": {},
+		"Photos/2024/notes.txt":    {},
+		"photos/IMG_0003.jpg":      {},
+		"Music/a.mp3":              {},
+	}
+
+	tests := []struct {
+		pattern string
+		want    []walkFuncArgs
+	}{
+		{
+			pattern: "photos/2024/img_*.jpg",
+			want: []walkFuncArgs{
+				{Path: "Photos/2024/IMG_0001.jpg"},
+				{Path: "Photos/2024/img_0002.JPG"},
+			},
+		},
+		{
+			pattern: "PHOTOS/**/*.jpg",
+			want: []walkFuncArgs{
+				{Path: "Photos/2024/IMG_0001.jpg"},
+				{Path: "Photos/2024/img_0002.JPG"},
+				{Path: "photos/IMG_0003.jpg"},
+			},
+		},
+		{
+			pattern: "music/A.MP3",
+			want: []walkFuncArgs{
+				{Path: "Music/a.mp3"},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		p, err := Parse(test.pattern, CaseInsensitive(true))
+		if err != nil {
+			t.Fatalf("Parse(%q) = %v", test.pattern, err)
+		}
+
+		var got walkFuncCalls
+		if err := p.Glob(got.walkFunc, traceLogOpt, WithFilesystem(fsys)); err != nil {
+			t.Fatalf("Glob(...) = %v", err)
+		}
+
+		if diff := cmp.Diff(got.calls, test.want); diff != "" {
+			t.Errorf("%q walked paths diff (-got +want):\n%s", test.pattern, diff)
+		}
+	}
+}
+
+func TestGlob_CaseInsensitiveSkipAll(t *testing.T) {
+	fsys := fstest.MapFS{
+		"C/d/1": {},
+		"c/d/2": {},
+	}
+	p, err := Parse("c/*/*", CaseInsensitive(true))
+	if err != nil {
+		t.Fatalf("Parse(c/*/*) = %v", err)
+	}
+
+	// Both C and c are roots, but fs.SkipAll stops the whole glob.
+	var got []string
+	err = p.Glob(func(path string, d fs.DirEntry, err error) error {
+		got = append(got, path)
+		return fs.SkipAll
+	}, traceLogOpt, WithFilesystem(fsys))
+	if err != nil {
+		t.Fatalf("Glob(...) = %v", err)
+	}
+	if want := []string{"C/d"}; !cmp.Equal(got, want) {
+		t.Errorf("Glob(...) called back with %q, want %q", got, want)
+	}
+}
+
+// readDirRecorder records the directories read from the filesystem.
+type readDirRecorder struct {
+	fs.FS
+	mu    sync.Mutex
+	reads []string
+}
+
+// ReadLink and Lstat are needed for literal names to be stat-ed rather than
+// reading the directory (see readDirFrom).
+func (r *readDirRecorder) ReadLink(name string) (string, error) {
+	return r.FS.(lstatFS).ReadLink(name)
+}
+
+func (r *readDirRecorder) Lstat(name string) (fs.FileInfo, error) {
+	return r.FS.(lstatFS).Lstat(name)
+}
+
+func (r *readDirRecorder) ReadDir(name string) ([]fs.DirEntry, error) {
+	r.mu.Lock()
+	r.reads = append(r.reads, name)
+	r.mu.Unlock()
+	return fs.ReadDir(r.FS, name)
+}
+
+func TestGlob_HideDotfiles(t *testing.T) {
+	fsys := &readDirRecorder{
+		FS: fstest.MapFS{
+			"package.json":                  {},
+			".eslintrc.json":                {},
+			".git/config.json":              {},
+			"src/app.json":                  {},
+			"src/.hidden.json":              {},
+			"node_modules/a/a.json":         {},
+			"node_modules/.cache/c.json":    {},
+			"node_modules/.cache/d/e.json":  {},
+			"node_modules/a/.cache/f.json":  {},
+			"node_modules/a/.cache/g/.json": {},
+		},
+	}
+
+	p, err := Parse("**/*.json", MatchDotfiles(false))
+	if err != nil {
+		t.Fatalf("Parse(**/*.json) = %v", err)
+	}
+
+	var got walkFuncCalls
+	if err := p.Glob(got.walkFunc, traceLogOpt, WithFilesystem(fsys)); err != nil {
+		t.Fatalf("Glob(...) = %v", err)
+	}
+
+	want := []walkFuncArgs{
+		{Path: "node_modules/a/a.json"},
+		{Path: "package.json"},
+		{Path: "src/app.json"},
+	}
+	if diff := cmp.Diff(got.calls, want); diff != "" {
+		t.Errorf("walked paths diff (-got +want):\n%s", diff)
+	}
+
+	// The hidden directories should never have been read.
+	wantReads := []string{".", "node_modules", "node_modules/a", "src"}
+	if diff := cmp.Diff(fsys.reads, wantReads); diff != "" {
+		t.Errorf("read directories diff (-got +want):\n%s", diff)
+	}
+}
+
+func TestGlob_MatchBase(t *testing.T) {
+	fsys := fstest.MapFS{
+		"a.o":       {},
+		"a.c":       {},
+		"lib/b.o":   {},
+		"lib/x/c.o": {},
+		"src/d.o":   {},
+	}
+
+	tests := []struct {
+		pattern  string
+		wantRoot string
+		want     []walkFuncArgs
+	}{
+		{
+			pattern:  "*.o",
+			wantRoot: "",
+			want: []walkFuncArgs{
+				{Path: "a.o"},
+				{Path: "lib/b.o"},
+				{Path: "lib/x/c.o"},
+				{Path: "src/d.o"},
+			},
+		},
+		{
+			pattern:  "/*.o",
+			wantRoot: "",
+			want: []walkFuncArgs{
+				{Path: "a.o"},
+			},
+		},
+		{
+			pattern:  "lib/*.o",
+			wantRoot: "lib/",
+			want: []walkFuncArgs{
+				{Path: "lib/b.o"},
+			},
+		},
+	}
+
+	for _, test := range tests {
+		p, err := Parse(test.pattern, MatchBase(true), WithSwapSlashes(false))
+		if err != nil {
+			t.Fatalf("Parse(%q) = %v", test.pattern, err)
+		}
+		if got, want := p.root, test.wantRoot; got != want {
+			t.Errorf("Parse(%q).root = %q, want %q", test.pattern, got, want)
+		}
+
+		var got walkFuncCalls
+		if err := p.Glob(got.walkFunc, traceLogOpt, WithFilesystem(fsys)); err != nil {
+			t.Fatalf("Glob(...) = %v", err)
+		}
+
+		if diff := cmp.Diff(got.calls, test.want); diff != "" {
+			t.Errorf("%q walked paths diff (-got +want):\n%s", test.pattern, diff)
+		}
+	}
+}
+
+func TestGlob_TrailingSlash(t *testing.T) {
+	tests := []struct {
+		pattern   string
+		opts      []GlobOption
+		want      []walkFuncArgs
+		wantReads []string
+	}{
+		{
+			pattern: "a/b/c*d/",
+			want: []walkFuncArgs{
+				{Path: "a/b/cad"},
+				{Path: "a/b/cd"},
+				{Path: "a/b/cid"}, // symlink to cod
+				{Path: "a/b/cod"},
+			},
+			wantReads: []string{"a/b"},
+		},
+		{
+			pattern: "a/b/c*d/",
+			opts:    []GlobOption{TraverseSymlinks(false)},
+			want: []walkFuncArgs{
+				{Path: "a/b/cad"},
+				{Path: "a/b/cd"},
+				{Path: "a/b/cid"},
+				{Path: "a/b/cod"},
+			},
+			wantReads: []string{"a/b"},
+		},
+		{
+			pattern: "a/b/c*d/e?f/",
+			want: []walkFuncArgs{
+				{Path: "a/b/cd/elf"},
+				{Path: "a/b/cid/erf"},
+				{Path: "a/b/cod/erf"},
+			},
+			wantReads: []string{"a/b", "a/b/cad", "a/b/cd", "a/b/cid", "a/b/cod"},
+		},
+		{
+			pattern: "a/b/cad/",
+			want: []walkFuncArgs{
+				{Path: "a/b/cad"},
+			},
+		},
+		{
+			pattern: "a/b/cad/m/",
+		},
+		{
+			// Finite, so a/b/cad/m is stat-ed instead of reading a/b/cad.
+			pattern: "a/b/cad/[m]/",
+		},
+	}
+
+	for _, test := range tests {
+		p, err := Parse(test.pattern)
+		if err != nil {
+			t.Fatalf("Parse(%q) = %v", test.pattern, err)
+		}
+
+		fsys := &readDirRecorder{FS: os.DirFS("fixtures")}
+		var got walkFuncCalls
+		opts := append([]GlobOption{traceLogOpt, WithFilesystem(fsys)}, test.opts...)
+		if err := p.Glob(got.walkFunc, opts...); err != nil {
+			t.Fatalf("Glob(...) = %v", err)
+		}
+
+		if diff := cmp.Diff(got.calls, test.want); diff != "" {
+			t.Errorf("%q walked paths diff (-got +want):\n%s", test.pattern, diff)
+		}
+		if diff := cmp.Diff(fsys.reads, test.wantReads); diff != "" {
+			t.Errorf("%q read directories diff (-got +want):\n%s", test.pattern, diff)
+		}
+	}
+}
+
+func TestGlob_SegmentRepetition(t *testing.T) {
+	mapfs := fstest.MapFS{
+		"src/a.go":         {},
+		"src/x/b.go":       {},
+		"src/x/y/c.go":     {},
+		"src/x/y/z/d.go":   {},
+		"src/x/y/z/w/e.go": {},
+	}
+
+	tests := []struct {
+		pattern   string
+		want      []walkFuncArgs
+		wantReads []string
+	}{
+		{
+			pattern: "src/**{0,2}/*.go",
+			want: []walkFuncArgs{
+				{Path: "src/a.go"},
+				{Path: "src/x/b.go"},
+				{Path: "src/x/y/c.go"},
+			},
+			wantReads: []string{"src", "src/x", "src/x/y"},
+		},
+		{
+			pattern: "src/*/{1,2}",
+			want: []walkFuncArgs{
+				{Path: "src/x"},
+				{Path: "src/x/y"},
+			},
+			wantReads: []string{"src", "src/x"},
+		},
+	}
+
+	for _, test := range tests {
+		p, err := Parse(test.pattern, AllowSegmentRepetition(true))
+		if err != nil {
+			t.Fatalf("Parse(%q) = %v", test.pattern, err)
+		}
+
+		fsys := &readDirRecorder{FS: mapfs}
+		var got walkFuncCalls
+		if err := p.Glob(got.walkFunc, traceLogOpt, WithFilesystem(fsys)); err != nil {
+			t.Fatalf("Glob(...) = %v", err)
+		}
+
+		if diff := cmp.Diff(got.calls, test.want); diff != "" {
+			t.Errorf("%q walked paths diff (-got +want):\n%s", test.pattern, diff)
+		}
+		if diff := cmp.Diff(fsys.reads, test.wantReads); diff != "" {
+			t.Errorf("%q read directories diff (-got +want):\n%s", test.pattern, diff)
+		}
+	}
+}
+
+// deepMapFS returns a filesystem with a tree of the given depth and fanout,
+// with a few files in every directory.
+func deepMapFS(depth, fanout int) fstest.MapFS {
+	fsys := make(fstest.MapFS)
+	var fill func(dir string, depth int)
+	fill = func(dir string, depth int) {
+		for _, name := range []string{"a.go", "a_test.go", "README"} {
+			fsys[path.Join(dir, name)] = &fstest.MapFile{}
+		}
+		if depth == 0 {
+			return
+		}
+		for i := 0; i < fanout; i++ {
+			fill(path.Join(dir, fmt.Sprintf("d%d", i)), depth-1)
+		}
+	}
+	fill("src", depth)
+	return fsys
+}
+
+func TestGlob_DeepTreeAgreesWithMatch(t *testing.T) {
+	fsys := deepMapFS(5, 2)
+	for _, pattern := range []string{"src/**/*_test.go", "src/d0/**/d1/*.go", "**/d1/d?/README"} {
+		p, err := Parse(pattern)
+		if err != nil {
+			t.Fatalf("Parse(%q) = %v", pattern, err)
+		}
+
+		var got walkFuncCalls
+		if err := p.Glob(got.walkFunc, traceLogOpt, WithFilesystem(fsys)); err != nil {
+			t.Fatalf("Glob(...) = %v", err)
+		}
+		got.sortCalls()
+
+		var want []walkFuncArgs
+		for name := range fsys {
+			if p.Match(name) {
+				want = append(want, walkFuncArgs{Path: name})
+			}
+		}
+		sort.Slice(want, func(i, j int) bool { return want[i].Path < want[j].Path })
+
+		if len(want) == 0 {
+			t.Errorf("%q matched nothing in the test filesystem", pattern)
+		}
+		if diff := cmp.Diff(got.calls, want); diff != "" {
+			t.Errorf("%q walked paths diff (-got +want):\n%s", pattern, diff)
+		}
+	}
+}
+
+func BenchmarkGlob_DeepTree(b *testing.B) {
+	fsys := deepMapFS(8, 2)
+	p := MustParse("src/**/*_test.go")
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if err := p.Glob(func(string, fs.DirEntry, error) error { return nil }, WithFilesystem(fsys)); err != nil {
+			b.Fatalf("Glob(...) = %v", err)
+		}
+	}
+}
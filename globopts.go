@@ -1,8 +1,13 @@
 package zzglob
 
 import (
+	"context"
 	"io"
 	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
 )
 
 // GlobOption functions optionally alter how Glob operates.
@@ -15,6 +20,19 @@ type globConfig struct {
 	traceLogger          io.Writer
 	filesystem           fs.FS
 	goroutines           int // only used by MultiGlob
+	parallelism          int
+	preserveOrder        bool
+
+	logMu sync.Mutex // serialises trace logs from parallel walks
+
+	// ctx stops walks when done. Nil means they are never cancelled. It
+	// isn't exported as an option, since Glob doesn't take a context
+	// (MultiGlob does), but All stops the walk with it.
+	ctx context.Context
+
+	// skippedAll is set when the callback returns fs.SkipAll (see
+	// watchSkipAll).
+	skippedAll atomic.Bool
 
 	callback fs.WalkDirFunc // the required arg to Glob
 }
@@ -36,7 +54,10 @@ func WithTraceLogs(out io.Writer) GlobOption {
 }
 
 // TraverseSymlinks enables or disables the traversal of symlinks during
-// globbing. It is enabled by default.
+// globbing. When disabled, a symlink is only stat-ed if the pattern could
+// match a / after it, to find out if it is a symlink to a directory (which
+// matches as a directory). Otherwise it matches as a non-directory, as with
+// [fs.WalkDir]. It is enabled by default.
 func TraverseSymlinks(traverse bool) GlobOption {
 	return func(cfg *globConfig) {
 		cfg.traverseSymlinks = traverse
@@ -87,3 +108,69 @@ func GoroutineLimit(n int) GlobOption {
 		cfg.goroutines = n
 	}
 }
+
+// Parallelism sets how many goroutines each walk uses to read directories.
+// Directories that can't contain a match are still skipped, and the callback
+// is never called concurrently from within one walk, but by default results
+// are passed to the callback in no particular order (see PreserveOrder).
+// Parallelism has no effect unless n > 1. By default directories are read
+// one at a time.
+func Parallelism(n int) GlobOption {
+	return func(cfg *globConfig) {
+		cfg.parallelism = n
+	}
+}
+
+// PreserveOrder enables or disables passing results to the callback in the
+// same order as [fs.WalkDir] when walking with Parallelism. Directories are
+// still read in parallel (including a few per goroutine ahead of the
+// callback), and the results are held back until everything before them has
+// been passed to the callback. A directory passed to the callback isn't read until the callback
+// has returned, so returning [fs.SkipDir] still avoids reading it. Without
+// Parallelism, results are always in order. Disabled by default.
+func PreserveOrder(enable bool) GlobOption {
+	return func(cfg *globConfig) {
+		cfg.preserveOrder = enable
+	}
+}
+
+// readDir reads the named directory (which uses forward slashes), either from
+// the overridden filesystem or the host filesystem.
+func (cfg *globConfig) readDir(dir string) ([]fs.DirEntry, error) {
+	if cfg.filesystem != nil {
+		return fs.ReadDir(cfg.filesystem, dir)
+	}
+	if cfg.translateSlashes {
+		dir = filepath.FromSlash(dir)
+	}
+	return os.ReadDir(dir)
+}
+
+// watchSkipAll wraps the callback so that skippedAll is set when it returns
+// [fs.SkipAll]. Each walk returns nil in that case (like [fs.WalkDir]), so
+// this is how globbing from several roots knows not to walk the rest.
+func (cfg *globConfig) watchSkipAll() {
+	f := cfg.callback
+	cfg.callback = func(path string, d fs.DirEntry, err error) error {
+		err = f(path, d, err)
+		if err == fs.SkipAll {
+			cfg.skippedAll.Store(true)
+		}
+		return err
+	}
+}
+
+// withContext sets the context that stops walks (see globConfig.ctx).
+func withContext(ctx context.Context) GlobOption {
+	return func(cfg *globConfig) {
+		cfg.ctx = ctx
+	}
+}
+
+// context returns the context that stops walks.
+func (cfg *globConfig) context() context.Context {
+	if cfg.ctx == nil {
+		return context.Background()
+	}
+	return cfg.ctx
+}
@@ -1,5 +1,5 @@
 module drjosh.dev/zzglob
 
-go 1.21
+go 1.23
 
 require github.com/google/go-cmp v0.7.0
@@ -0,0 +1,107 @@
+package zzglob
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"iter"
+	"slices"
+)
+
+// Match is a path found by globbing, as it would be passed to the callback
+// given to Glob.
+type Match struct {
+	Path  string
+	Entry fs.DirEntry // nil if the path couldn't be stat-ed
+}
+
+// All globs for files matching the pattern (like Glob), and returns an
+// iterator over them. Errors encountered while walking (e.g. permissions
+// errors) are yielded with the path they apply to, and the walk continues.
+// An error that stops the walk is yielded last, with an empty Match.
+// Breaking out of the loop stops the walk. The walk runs in another
+// goroutine, which has stopped by the time the loop finishes.
+func (p *Pattern) All(opts ...GlobOption) iter.Seq2[Match, error] {
+	return globSeq(context.Background(), func(ctx context.Context, f fs.WalkDirFunc) error {
+		return p.Glob(f, append(slices.Clip(opts), withContext(ctx))...)
+	})
+}
+
+// MultiGlobAll is like All, but globs multiple patterns simultaneously (like
+// MultiGlob). The callback isn't needed, so MultiGlobAll is safe to use
+// without GoroutineLimit. Breaking out of the loop cancels the walks, and
+// they have all stopped by the time the loop finishes.
+func MultiGlobAll(ctx context.Context, patterns []*Pattern, opts ...GlobOption) iter.Seq2[Match, error] {
+	return globSeq(ctx, func(ctx context.Context, f fs.WalkDirFunc) error {
+		return MultiGlob(ctx, patterns, f, opts...)
+	})
+}
+
+// GlobSlice globs for files matching the pattern, and returns the paths in
+// sorted order. See Collect.
+func (p *Pattern) GlobSlice(opts ...GlobOption) ([]string, error) {
+	return Collect(p.All(opts...))
+}
+
+// Collect returns the paths from a sequence of matches (e.g. from All or
+// MultiGlobAll), sorted and without duplicates, together with every error
+// (joined with errors.Join). Paths yielded with an error are not included.
+func Collect(seq iter.Seq2[Match, error]) ([]string, error) {
+	var paths []string
+	var errs []error
+	for m, err := range seq {
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		paths = append(paths, m.Path)
+	}
+	slices.Sort(paths)
+	return slices.Compact(paths), errors.Join(errs...)
+}
+
+// globResult is a match (or error) sent from the walk to the loop.
+type globResult struct {
+	match Match
+	err   error
+}
+
+// globSeq returns an iterator over the results of glob, which calls f for
+// each result. glob runs in a separate goroutine, because the callback isn't
+// necessarily called from the goroutine that calls glob (e.g. MultiGlob, or
+// with Parallelism), but the loop body must only run in the goroutine that
+// is iterating.
+func globSeq(ctx context.Context, glob func(context.Context, fs.WalkDirFunc) error) iter.Seq2[Match, error] {
+	return func(yield func(Match, error) bool) {
+		ctx, cancel := context.WithCancel(ctx)
+		defer cancel()
+
+		results := make(chan globResult)
+		var globErr error
+		go func() {
+			defer close(results)
+			globErr = glob(ctx, func(path string, d fs.DirEntry, err error) error {
+				select {
+				case results <- globResult{Match{Path: path, Entry: d}, err}:
+					return nil
+				case <-ctx.Done():
+					// The loop has finished.
+					return fs.SkipAll
+				}
+			})
+		}()
+
+		for r := range results {
+			if !yield(r.match, r.err) {
+				// Stop the walk, and wait for it to finish.
+				cancel()
+				for range results {
+				}
+				return
+			}
+		}
+		if globErr != nil {
+			yield(Match{}, globErr)
+		}
+	}
+}
@@ -0,0 +1,170 @@
+package zzglob
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestPattern_All(t *testing.T) {
+	p := MustParse("fixtures/**/*_spec.rb")
+
+	var want walkFuncCalls
+	if err := p.Glob(want.walkFunc, traceLogOpt); err != nil {
+		t.Fatalf("Glob(...) = %v", err)
+	}
+
+	var got []walkFuncArgs
+	for m, err := range p.All(traceLogOpt) {
+		got = append(got, walkFuncArgs{Path: m.Path, Err: err})
+	}
+	if diff := cmp.Diff(got, want.calls); diff != "" {
+		t.Errorf("All paths diff (-got +want):\n%s", diff)
+	}
+}
+
+func TestPattern_All_Error(t *testing.T) {
+	// A pattern root that isn't valid in the filesystem stops the walk.
+	p := MustParse("../**")
+	var got []walkFuncArgs
+	for m, err := range p.All(traceLogOpt, WithFilesystem(deepMapFS(1, 1))) {
+		got = append(got, walkFuncArgs{Path: m.Path, Err: err})
+	}
+	if len(got) != 1 || got[0].Path != "" || got[0].Err == nil {
+		t.Errorf("All yielded %v, want only an error", got)
+	}
+}
+
+func TestPattern_All_Break(t *testing.T) {
+	// src/{d0,d1}/**/*.go is walked from src/d0 and src/d1 separately.
+	for _, pattern := range []string{"src/**/*.go", "src/{d0,d1}/**/*.go"} {
+		p := MustParse(pattern)
+		split := len(p.globStarts(&globConfig{traverseSymlinks: true})) > 1
+		full := &readDirRecorder{FS: deepMapFS(4, 3)}
+		if err := p.Glob(func(string, fs.DirEntry, error) error { return nil }, traceLogOpt, WithFilesystem(full)); err != nil {
+			t.Fatalf("%q Glob(...) = %v", pattern, err)
+		}
+
+		for _, parallelism := range []int{1, 4} {
+			fsys := &readDirRecorder{FS: deepMapFS(4, 3)}
+			n := 0
+			for _, err := range p.All(traceLogOpt, WithFilesystem(fsys), Parallelism(parallelism)) {
+				if err != nil {
+					t.Fatalf("%q All(..., Parallelism(%d)) yielded error %v", pattern, parallelism, err)
+				}
+				n++
+				if n == 3 {
+					break
+				}
+			}
+			if n != 3 {
+				t.Errorf("%q All(..., Parallelism(%d)) yielded %d matches before break, want 3", pattern, parallelism, n)
+			}
+
+			// The walk has finished by the time the loop has, so nothing more
+			// is read. When split, the first 3 matches are in src/d0, so
+			// src/d1 is never walked.
+			fsys.mu.Lock()
+			reads := slices.Clone(fsys.reads)
+			fsys.mu.Unlock()
+			if len(reads) >= len(full.reads) {
+				t.Errorf("%q All(..., Parallelism(%d)) read %d directories after break, want fewer than %d", pattern, parallelism, len(reads), len(full.reads))
+			}
+			for _, r := range reads {
+				if split && strings.HasPrefix(r, "src/d1") {
+					t.Errorf("%q All(..., Parallelism(%d)) read %q after break", pattern, parallelism, r)
+				}
+			}
+		}
+	}
+}
+
+func TestMultiGlobAll(t *testing.T) {
+	patterns := []*Pattern{
+		MustParse("src/d0/**/a.go"),
+		MustParse("src/*/d1/a.go"),
+	}
+
+	got, err := Collect(MultiGlobAll(context.Background(), patterns, traceLogOpt, WithFilesystem(deepMapFS(2, 2))))
+	if err != nil {
+		t.Fatalf("Collect(MultiGlobAll(...)) error = %v", err)
+	}
+
+	// src/d0/d1/a.go matches both patterns, but is only included once.
+	want := []string{
+		"src/d0/a.go",
+		"src/d0/d0/a.go",
+		"src/d0/d1/a.go",
+		"src/d1/d1/a.go",
+	}
+	if diff := cmp.Diff(got, want); diff != "" {
+		t.Errorf("Collect(MultiGlobAll(...)) diff (-got +want):\n%s", diff)
+	}
+}
+
+func TestMultiGlobAll_Break(t *testing.T) {
+	patterns := []*Pattern{
+		MustParse("src/d0/**"),
+		MustParse("src/d1/**"),
+		MustParse("src/d2/**"),
+	}
+	n := 0
+	for _, err := range MultiGlobAll(context.Background(), patterns, traceLogOpt, WithFilesystem(deepMapFS(4, 3))) {
+		if err != nil {
+			t.Fatalf("MultiGlobAll(...) yielded error %v", err)
+		}
+		n++
+		if n == 5 {
+			break
+		}
+	}
+	if n != 5 {
+		t.Errorf("MultiGlobAll(...) yielded %d matches before break, want 5", n)
+	}
+}
+
+func TestMultiGlobAll_Cancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	var errs []error
+	for _, err := range MultiGlobAll(ctx, []*Pattern{MustParse("src/**")}, traceLogOpt, WithFilesystem(deepMapFS(2, 2))) {
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if len(errs) == 0 || !errors.Is(errs[len(errs)-1], context.Canceled) {
+		t.Errorf("MultiGlobAll(cancelled context) errors = %v, want context.Canceled last", errs)
+	}
+}
+
+func TestPattern_GlobSlice(t *testing.T) {
+	got, err := MustParse("fixtures/**/*_spec.rb").GlobSlice(traceLogOpt)
+
+	// fixtures/spec/borked is a broken symlink.
+	if !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("GlobSlice(...) error = %v, want fs.ErrNotExist", err)
+	}
+	want := []string{
+		"fixtures/spec/bar_spec.rb",
+		"fixtures/spec/foo_spec.rb",
+		"fixtures/spec/model/qux_spec.rb",
+	}
+	if diff := cmp.Diff(got, want); diff != "" {
+		t.Errorf("GlobSlice(...) diff (-got +want):\n%s", diff)
+	}
+
+	got, err = MustParse("src/d1/*").GlobSlice(traceLogOpt, WithFilesystem(deepMapFS(1, 2)), Parallelism(2))
+	if err != nil {
+		t.Fatalf("GlobSlice(...) error = %v", err)
+	}
+	want = []string{"src/d1/README", "src/d1/a.go", "src/d1/a_test.go"}
+	if diff := cmp.Diff(got, want); diff != "" {
+		t.Errorf("GlobSlice(...) diff (-got +want):\n%s", diff)
+	}
+}
@@ -1,21 +1,78 @@
 package zzglob
 
-import "strings"
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
 
-// Match reports if the path matches the pattern.
+// Match reports if the path matches the pattern. Directories should be given
+// a trailing slash (or use MatchEntry) to be matched the same way as Glob.
 func (p *Pattern) Match(path string) bool {
 	if p.initial == nil {
 		// no state machine, only root
+		if p.inputConfig.caseInsensitive {
+			return strings.EqualFold(path, p.root)
+		}
 		return path == p.root
 	}
 
-	rem, ok := strings.CutPrefix(path, p.root)
+	rem, ok := p.cutRoot(path)
 	if !ok {
 		return false
 	}
-	set := matchSegment(singleton(p.initial), rem)
-	for n := range set {
-		if n.Accept {
+	return p.dfa.match(rem)
+}
+
+// MatchEntry reports if the path, which is a directory if isDir is true,
+// matches the pattern. Like Glob, directories are matched with a trailing
+// slash, so a pattern ending in a slash (e.g. "foo*/") matches only
+// directories. The path may already end with a slash if it is a directory.
+func (p *Pattern) MatchEntry(path string, isDir bool) bool {
+	if !isDir {
+		// Only directories can end with a slash.
+		return !strings.HasSuffix(path, "/") && p.Match(path)
+	}
+	if !strings.HasSuffix(path, "/") {
+		path += "/"
+	}
+	return p.Match(path)
+}
+
+// cutRoot returns path without the pattern root, and reports whether path
+// starts with the root at all.
+func (p *Pattern) cutRoot(path string) (string, bool) {
+	if p.inputConfig.caseInsensitive {
+		return cutPrefixFold(path, p.root)
+	}
+	return strings.CutPrefix(path, p.root)
+}
+
+// cutPrefixFold is like [strings.CutPrefix], but compares runes using Unicode
+// simple case folding (like [strings.EqualFold]).
+func cutPrefixFold(s, prefix string) (string, bool) {
+	for prefix != "" {
+		if s == "" {
+			return s, false
+		}
+		pr, pn := utf8.DecodeRuneInString(prefix)
+		sr, sn := utf8.DecodeRuneInString(s)
+		if !equalFoldRune(pr, sr) {
+			return s, false
+		}
+		prefix, s = prefix[pn:], s[sn:]
+	}
+	return s, true
+}
+
+// equalFoldRune reports whether a and b are equivalent under Unicode simple
+// case folding.
+func equalFoldRune(a, b rune) bool {
+	if a == b {
+		return true
+	}
+	for f := unicode.SimpleFold(a); f != a; f = unicode.SimpleFold(f) {
+		if f == b {
 			return true
 		}
 	}
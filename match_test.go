@@ -11,6 +11,7 @@ func TestMatch(t *testing.T) {
 	}{
 		{"a/b", "a/b", true},
 		{"a/b", "a/b/", false},
+		{"a/**/**", "a/", true},
 		{"a*b", "acccccb", true},
 		{"a*b", "abc", false},
 		{"a*b", "a/b", false},
@@ -23,6 +24,47 @@ func TestMatch(t *testing.T) {
 		{"a/[^bc]/d", "a/c/d", false},
 		{"a/[^bc]/d", "a/x/d", true},
 		{"a/[^bc]/d", "a/y/d", true},
+		{"[0-9]*.log", "7.log", true},
+		{"[0-9]*.log", "42.log", true},
+		{"[0-9]*.log", "-.log", false},
+		{"[0-9]*.log", "x.log", false},
+		{"a/[a-cx-z_]", "a/b", true},
+		{"a/[a-cx-z_]", "a/y", true},
+		{"a/[a-cx-z_]", "a/_", true},
+		{"a/[a-cx-z_]", "a/m", false},
+		{"a/[a-cx-z_]", "a/-", false},
+		{"[-a]", "-", true},
+		{"[a-]", "-", true},
+		{"[a-]", "b", false},
+		{`[a\-c]`, "-", true},
+		{`[a\-c]`, "b", false},
+		{"a/[^a-cx-z]/d", "a/b/d", false},
+		{"a/[^a-cx-z]/d", "a/z/d", false},
+		{"a/[^a-cx-z]/d", "a/m/d", true},
+		{"a/[^a-]/d", "a/-/d", false},
+		{"a/[^a-]/d", "a/b/d", true},
+		{"[\u4e00-\u9fff]", "\u4e2d", true},
+		{"[[:alpha:]]*", "abc", true},
+		{"[[:alpha:]]*", "été", true},
+		{"[[:alpha:]]*", "1bc", false},
+		{"x[[:digit:]_]", "x7", true},
+		{"x[[:digit:]_]", "x_", true},
+		{"x[[:digit:]_]", "xa", false},
+		{"[[:upper:]][[:lower:]]", "Ab", true},
+		{"[[:upper:]][[:lower:]]", "aB", false},
+		{"a[[:space:]]b", "a b", true},
+		{"a[^[:space:]]b", "a b", false},
+		{"a[^[:space:][:digit:]]b", "a1b", false},
+		{"a[^[:space:][:digit:]]b", "axb", true},
+		{`[\p{Han}]*.txt`, "中文.txt", true},
+		{`[\p{Han}]*.txt`, "zh.txt", false},
+		{`[\p{L}_]`, "_", true},
+		{`[\p{L}_]`, "ß", true},
+		{`[\p{L}_]`, "1", false},
+		{`[^\p{L}]`, "1", true},
+		{`[^\p{L}]`, "a", false},
+		{`[\P{L}]`, "1", true},
+		{`[\P{L}]`, "a", false},
 		{"a?b", "acb", true},
 		{"a?b", "accb", false},
 		{"a**b", "acb", true},
@@ -60,7 +102,7 @@ func TestMatch(t *testing.T) {
 	}
 
 	for _, test := range tests {
-		p, err := Parse(test.pattern)
+		p, err := Parse(test.pattern, AllowNamedCharClass(true))
 		if err != nil {
 			t.Fatalf("Parse(%q) error = %v", test.pattern, err)
 		}
@@ -71,3 +113,367 @@ func TestMatch(t *testing.T) {
 		}
 	}
 }
+
+func TestMatch_ExtGlob(t *testing.T) {
+	tests := []struct {
+		pattern, path string
+		want          bool
+	}{
+		{"a@(b|c)d", "abd", true},
+		{"a@(b|c)d", "acd", true},
+		{"a@(b|c)d", "ad", false},
+		{"a@(b|c)d", "abcd", false},
+		{"a?(b|c)d", "ad", true},
+		{"a?(b|c)d", "abd", true},
+		{"a?(b|c)d", "abbd", false},
+		{"a*(b|c)d", "ad", true},
+		{"a*(b|c)d", "abcbd", true},
+		{"a*(b|c)d", "abxd", false},
+		{"a+(b|c)d", "ad", false},
+		{"a+(b|c)d", "acd", true},
+		{"a+(b|c)d", "acbbd", true},
+		{"*(|x)y", "xxy", true},
+		{"!(*_test).go", "main.go", true},
+		{"!(*_test).go", "main_test.go", false},
+		{"!(*_test).go", "main_test.go.go", true},
+		{"!(*_test).go", "a/main.go", false},
+		{"!(foo)", "fox", true},
+		{"!(foo)", "fooo", true},
+		{"!(foo)", "foo", false},
+		{"!(foo)", "", true},
+		{"!(foo|bar)/x", "baz/x", true},
+		{"!(foo|bar)/x", "bar/x", false},
+		{"x/!([[:digit:]]*)", "x/abc", true},
+		{"x/!([[:digit:]]*)", "x/1bc", false},
+		{"a/+(b|c)/@(d|e*)", "a/bcb/eee", true},
+		{"a|b)", "a|b)", true},
+		{"a@(b|c", "a@(b|c", false},
+	}
+
+	for _, test := range tests {
+		p, err := Parse(test.pattern, AllowExtGlob(true), AllowNamedCharClass(true))
+		if err != nil {
+			if test.want {
+				t.Errorf("Parse(%q) error = %v", test.pattern, err)
+			}
+			continue
+		}
+
+		if got, want := p.Match(test.path), test.want; got != want {
+			t.Errorf("(%q).Match(%q) = %v, want %v", test.pattern, test.path, got, want)
+		}
+	}
+}
+
+func TestMatch_BraceSequence(t *testing.T) {
+	tests := []struct {
+		pattern, path string
+		want          bool
+	}{
+		{"shard-{00..15}/*.parquet", "shard-00/a.parquet", true},
+		{"shard-{00..15}/*.parquet", "shard-07/a.parquet", true},
+		{"shard-{00..15}/*.parquet", "shard-15/a.parquet", true},
+		{"shard-{00..15}/*.parquet", "shard-16/a.parquet", false},
+		{"shard-{00..15}/*.parquet", "shard-7/a.parquet", false},
+		{"{1..10}", "0", false},
+		{"{1..10}", "1", true},
+		{"{1..10}", "10", true},
+		{"{1..10}", "01", false},
+		{"{1..10}", "11", false},
+		{"{10..1}", "5", true},
+		{"{01..20..2}", "01", true},
+		{"{01..20..2}", "03", true},
+		{"{01..20..2}", "04", false},
+		{"{01..20..2}", "19", true},
+		{"{01..20..2}", "21", false},
+		{"{10..1..3}", "10", true},
+		{"{10..1..3}", "7", true},
+		{"{10..1..3}", "1", true},
+		{"{10..1..3}", "2", false},
+		{"{-3..3}", "-3", true},
+		{"{-3..3}", "0", true},
+		{"{-3..3}", "-4", false},
+		{"{-3..3}", "-0", false},
+		{"{-05..05}", "-03", true},
+		{"{-05..05}", "003", true},
+		{"{-05..05}", "3", false},
+		{"{1..1000000}", "999999", true},
+		{"{1..1000000}", "1000000", true},
+		{"{1..1000000}", "1000001", false},
+		{"{a..f}/index", "c/index", true},
+		{"{a..f}/index", "g/index", false},
+		{"{a..f..2}", "c", true},
+		{"{a..f..2}", "d", false},
+		{"{f..a..2}", "d", true},
+		{"{a..z..25}", "z", true},
+		{"{a..z..26}", "a", true},
+		{"{a..z..26}", "z", false},
+		{"{a..z..4294967296}", "a", true},
+		{"{a..z..4294967296}", "b", false},
+		{"{z..a..-4294967297}", "z", true},
+		{"{z..a..-4294967297}", "y", false},
+		{"{a,b}{1..3}", "b2", true},
+		{"{1..3,5}", "1..3", true},
+		{"{1..3,5}", "2", false},
+	}
+
+	for _, test := range tests {
+		p, err := Parse(test.pattern, AllowBraceSequence(true))
+		if err != nil {
+			t.Fatalf("Parse(%q) error = %v", test.pattern, err)
+		}
+
+		if got, want := p.Match(test.path), test.want; got != want {
+			t.Errorf("(%q).Match(%q) = %v, want %v", test.pattern, test.path, got, want)
+		}
+	}
+}
+
+func TestMatch_NumericRange(t *testing.T) {
+	tests := []struct {
+		pattern, path string
+		want          bool
+	}{
+		{"frame<0-299>.png", "frame7.png", true},
+		{"frame<0-299>.png", "frame007.png", true},
+		{"frame<0-299>.png", "frame0.png", true},
+		{"frame<0-299>.png", "frame000.png", true},
+		{"frame<0-299>.png", "frame299.png", true},
+		{"frame<0-299>.png", "frame300.png", false},
+		{"frame<0-299>.png", "frame.png", false},
+		{"frame<0-299>.png", "frame1x.png", false},
+		{"log.<5->", "log.4", false},
+		{"log.<5->", "log.5", true},
+		{"log.<5->", "log.05", true},
+		{"log.<5->", "log.10", true},
+		{"log.<5->", "log.123456789012345678901234567890", true},
+		{"log.<10->", "log.9", false},
+		{"log.<10->", "log.10", true},
+		{"log.<10->", "log.100", true},
+		{"<-10>", "0", true},
+		{"<-10>", "10", true},
+		{"<-10>", "0010", true},
+		{"<-10>", "11", false},
+		{"<->", "1234567890123456789012345", true},
+		{"<->", "", false},
+		{"<->", "x", false},
+		{"<1-5>/*", "3/x", true},
+		{"<1-5>/*", "6/x", false},
+		{"<1-x>", "<1-x>", true},
+		{"a<b", "a<b", true},
+	}
+
+	for _, test := range tests {
+		p, err := Parse(test.pattern, AllowNumericRange(true))
+		if err != nil {
+			t.Fatalf("Parse(%q) error = %v", test.pattern, err)
+		}
+
+		if got, want := p.Match(test.path), test.want; got != want {
+			t.Errorf("(%q).Match(%q) = %v, want %v", test.pattern, test.path, got, want)
+		}
+	}
+}
+
+func TestMatch_CaseInsensitive(t *testing.T) {
+	tests := []struct {
+		pattern, path string
+		want          bool
+	}{
+		{"Photos/IMG_*.JPG", "photos/img_0001.jpg", true},
+		{"Photos/IMG_*.JPG", "PHOTOS/IMG_0001.JPG", true},
+		{"Photos/IMG_*.JPG", "photos/img_0001.png", false},
+		{"README", "readme", true},
+		{"README", "readme.md", false},
+		{"a/[a-c]", "a/B", true},
+		{"a/[a-c]", "a/D", false},
+		{"a/[^a-c]", "a/B", false},
+		{"a/[^a-c]", "a/D", true},
+		{"a/[^x]", "a/X", false},
+		{"a/[[:lower:]]", "a/Q", true},
+		{"a/[[:upper:]]", "a/q", true},
+		{"a/[^[:lower:]]", "a/Q", false},
+		{`a/[\p{Lu}]`, "a/q", true},
+		{`a/[\P{Lu}]`, "a/Q", false},
+		{"{foo,bar}.txt", "BAR.TXT", true},
+		{"k.txt", "K.txt", true}, // KELVIN SIGN
+		{"s*", "ſx", true},       // LATIN SMALL LETTER LONG S
+		{"!(foo).txt", "FOO.txt", false},
+		{"!(foo).txt", "FOX.txt", true},
+		{"*(ab)c", "AbaBC", true},
+		{"{a..c}", "B", true},
+		{"[ß]", "ẞ", true},
+	}
+
+	for _, test := range tests {
+		p, err := Parse(test.pattern, CaseInsensitive(true), AllowExtGlob(true), AllowBraceSequence(true), AllowNamedCharClass(true))
+		if err != nil {
+			t.Fatalf("Parse(%q) error = %v", test.pattern, err)
+		}
+
+		if got, want := p.Match(test.path), test.want; got != want {
+			t.Errorf("(%q).Match(%q) = %v, want %v", test.pattern, test.path, got, want)
+		}
+	}
+}
+
+func TestMatch_HideDotfiles(t *testing.T) {
+	tests := []struct {
+		pattern, path string
+		want          bool
+	}{
+		{"*", "a", true},
+		{"*", ".a", false},
+		{"*", "a.b", true},
+		{".*", ".a", true},
+		{"?a", ".a", false},
+		{"[^x]a", ".a", false},
+		{"[^x]a", "ba", true},
+		{"[!-0]a", ".a", false},
+		{`[\P{L}]a`, ".a", false},
+		{`[\P{L}]a`, "1a", true},
+		{"a/*", "a/.b", false},
+		{"a/.*", "a/.b", true},
+		{"a/*.b", "a/c.b", true},
+		{"**/*.json", "a/b/c.json", true},
+		{"**/*.json", ".git/c.json", false},
+		{"**/*.json", "a/.cache/c.json", false},
+		{"**/*.json", "a/.c.json", false},
+		{"**/.*.json", "a/.c.json", true},
+		{"**", "a/b/c", true},
+		{"**", "a/.b/c", false},
+		{"a**", "ab/c", true},
+		{"a**", "a/.c", false},
+		{".git/**", ".git/config", true},
+		{".git/**", ".git/.config", false},
+		{"{.,}*", ".a", true},
+		{"!(foo)", ".a", false},
+		{"!(foo)", "a", true},
+		{"+(.a)", ".a.a", true},
+	}
+
+	for _, test := range tests {
+		p, err := Parse(test.pattern, MatchDotfiles(false), AllowExtGlob(true), AllowNamedCharClass(true))
+		if err != nil {
+			t.Fatalf("Parse(%q) error = %v", test.pattern, err)
+		}
+
+		if got, want := p.Match(test.path), test.want; got != want {
+			t.Errorf("(%q).Match(%q) = %v, want %v", test.pattern, test.path, got, want)
+		}
+	}
+}
+
+func TestMatch_MatchBase(t *testing.T) {
+	tests := []struct {
+		pattern, path string
+		want          bool
+	}{
+		{"*.o", "a.o", true},
+		{"*.o", "a/b/c.o", true},
+		{"*.o", "a/b/c.c", false},
+		{"core", "core", true},
+		{"core", "x/core", true},
+		{"core", "x/core/y", false},
+		{"/*.o", "a.o", true},
+		{"/*.o", "a/b.o", false},
+		{"/core", "core", true},
+		{"/core", "x/core", false},
+		{"doc/*.txt", "doc/a.txt", true},
+		{"doc/*.txt", "x/doc/a.txt", false},
+		{"**/doc", "x/doc", true},
+	}
+
+	for _, test := range tests {
+		p, err := Parse(test.pattern, MatchBase(true), WithSwapSlashes(false))
+		if err != nil {
+			t.Fatalf("Parse(%q) error = %v", test.pattern, err)
+		}
+
+		if got, want := p.Match(test.path), test.want; got != want {
+			t.Errorf("(%q).Match(%q) = %v, want %v", test.pattern, test.path, got, want)
+		}
+	}
+}
+
+func TestMatchEntry(t *testing.T) {
+	tests := []struct {
+		pattern, path string
+		isDir         bool
+		want          bool
+	}{
+		{"foo*/", "foobar", true, true},
+		{"foo*/", "foobar/", true, true},
+		{"foo*/", "foobar", false, false},
+		{"foo*/", "foobar/", false, false},
+		{"foo*", "foobar", false, true},
+		{"foo*", "foobar", true, false},
+		{"a/b/", "a/b", true, true},
+		{"a/b/", "a/b", false, false},
+		{"**/", "a/b", true, true},
+		{"**/", "a/b", false, false},
+		{"**", "a/b", true, true},
+		{"**", "a/b", false, true},
+	}
+
+	for _, test := range tests {
+		p, err := Parse(test.pattern)
+		if err != nil {
+			t.Fatalf("Parse(%q) error = %v", test.pattern, err)
+		}
+
+		if got, want := p.MatchEntry(test.path, test.isDir), test.want; got != want {
+			t.Errorf("(%q).MatchEntry(%q, %t) = %v, want %v", test.pattern, test.path, test.isDir, got, want)
+		}
+	}
+}
+
+func TestMatch_SegmentRepetition(t *testing.T) {
+	tests := []struct {
+		pattern, path string
+		want          bool
+	}{
+		{"src/**{0,2}/*.go", "src/a.go", true},
+		{"src/**{0,2}/*.go", "src/x/a.go", true},
+		{"src/**{0,2}/*.go", "src/x/y/a.go", true},
+		{"src/**{0,2}/*.go", "src/x/y/z/a.go", false},
+		{"**{1,2}/*.go", "a.go", false},
+		{"**{1,2}/*.go", "x/a.go", true},
+		{"**{1,2}/*.go", "x/y/a.go", true},
+		{"**{1,2}/*.go", "x/y/z/a.go", false},
+		{"**{2}", "x", false},
+		{"**{2}", "x/y", true},
+		{"**{2}", "x/y/z", false},
+		{"a/**{1,}", "a/x/y/z", true},
+		{"a/**{1,}", "a", false},
+		{"a/**{,1}", "a/", true},
+		{"a/**{,1}", "a/x", true},
+		{"a/**{,1}", "a/x/y", false},
+		{"*/{1,3}", "a/", true},
+		{"*/{1,3}", "a/b/c/", true},
+		{"*/{1,3}", "a/b/c/d/", false},
+		{"*/{1,3}", "a", false},
+		{"x/*/{2}y", "x/a/b/y", true},
+		{"x/*/{2}y", "x/a/y", false},
+		{"x/a*/{0,}b", "x/b", true},
+		{"x/a*/{0,}b", "x/a1/a2/a3/b", true},
+		{"x/a*/{0,}b", "x/a1/c/b", false},
+		{"x/a/{2}", "x/a/a/", true},
+		{"x/a/{2}", "x/a/", false},
+		{"x/{1,2}", "x/x/", true},
+		{"x/{1,2}", "x/1", false},
+		{"a{1,2}", "a1", true},
+		{"*{1,2}", "a2", true},
+	}
+
+	for _, test := range tests {
+		p, err := Parse(test.pattern, AllowSegmentRepetition(true))
+		if err != nil {
+			t.Fatalf("Parse(%q) error = %v", test.pattern, err)
+		}
+
+		if got, want := p.Match(test.path), test.want; got != want {
+			t.Errorf("(%q).Match(%q) = %v, want %v", test.pattern, test.path, got, want)
+		}
+	}
+}
@@ -5,9 +5,12 @@ import (
 	"errors"
 	"fmt"
 	"io/fs"
+	"maps"
 	"os"
 	"path"
 	"path/filepath"
+	"slices"
+	"strings"
 	"sync"
 )
 
@@ -16,7 +19,12 @@ import (
 // calls to [fs.WalkDir] (reducing filesystem I/O), and then to use [fs.WalkDir]
 // on each root in parallel.
 // As a result, files can be walked globbed multiple times, but only if distinct
-// overlapping roots appear in different input patterns.
+// overlapping roots appear in different input patterns. Patterns that match
+// a few specific paths (see [Pattern.Paths]) aren't walked at all; instead
+// their paths are stat-ed, grouped by directory. Leading literal directories
+// are split into separate roots (e.g. {api,web}/src/*.go is walked from both
+// api/src and web/src), so even patterns that share one root may be walked
+// concurrently, and the callback can be called in any order.
 // You should either make sure that the callback f is safe to call concurrently
 // from multiple goroutines, or set GoroutineLimit to 1.
 func MultiGlob(ctx context.Context, patterns []*Pattern, f fs.WalkDirFunc, opts ...GlobOption) error {
@@ -37,16 +45,44 @@ func MultiGlob(ctx context.Context, patterns []*Pattern, f fs.WalkDirFunc, opts
 		o(cfg)
 	}
 
-	// Group patterns by cleaned root
-	byRoot := make(map[string][]*Pattern)
+	// Group patterns by cleaned root. Finite patterns aren't walked; instead
+	// their paths are grouped by directory, to be stat-ed.
+	byRoot := make(map[string]*multiglobWork)
+	byDir := make(map[string][]string)
 	for _, p := range patterns {
-		cleanRoot := path.Clean(p.root)
-		byRoot[cleanRoot] = append(byRoot[cleanRoot], p)
+		if paths, ok := p.globPaths(cfg); ok {
+			for _, fp := range paths {
+				dir := path.Dir(path.Clean(fp))
+				byDir[dir] = append(byDir[dir], fp)
+			}
+			continue
+		}
+		for _, st := range p.globStarts(cfg) {
+			w := byRoot[st.root]
+			if w == nil {
+				w = &multiglobWork{root: st.root, states: make(stateSet)}
+				byRoot[st.root] = w
+			}
+			if p.initial == nil {
+				w.patterns = append(w.patterns, p)
+				continue
+			}
+			maps.Copy(w.states, st.states)
+		}
+	}
+	var works []multiglobWork
+	for _, w := range byRoot {
+		works = append(works, *w)
+	}
+	for dir, paths := range byDir {
+		// Different patterns could have the same paths.
+		slices.SortFunc(paths, compareWalkOrder)
+		works = append(works, multiglobWork{root: dir, paths: slices.Compact(paths)})
 	}
 
 	// Spin up this many worker goroutines.
-	if cfg.goroutines <= 0 || cfg.goroutines > len(byRoot) {
-		cfg.goroutines = len(byRoot)
+	if cfg.goroutines <= 0 || cfg.goroutines > len(works) {
+		cfg.goroutines = len(works)
 	}
 	workCh := make(chan multiglobWork)
 	wctx, cancel := context.WithCancelCause(ctx)
@@ -56,21 +92,18 @@ func MultiGlob(ctx context.Context, patterns []*Pattern, f fs.WalkDirFunc, opts
 		wg.Add(1)
 		go func() {
 			defer wg.Done()
-			if err := multiglobWorker(ctx, cfg, workCh); err != nil {
+			if err := multiglobWorker(wctx, cfg, workCh); err != nil {
 				cancel(err)
 			}
 		}()
 	}
 
 	// Feed work to the workers
-	for root, patts := range byRoot {
-		work := multiglobWork{
-			root:     root,
-			patterns: patts,
-		}
+feed:
+	for _, work := range works {
 		select {
 		case <-wctx.Done():
-			return context.Cause(wctx)
+			break feed
 
 		case workCh <- work:
 			// work has been fed
@@ -78,26 +111,37 @@ func MultiGlob(ctx context.Context, patterns []*Pattern, f fs.WalkDirFunc, opts
 	}
 	close(workCh)
 
+	// Wait for the workers even if cancelled, so that the callback isn't
+	// called after MultiGlob returns.
 	wg.Wait()
 	return context.Cause(wctx)
 }
 
 type multiglobWork struct {
 	root     string
-	patterns []*Pattern
+	patterns []*Pattern // fully specified, so only root is stat-ed
+	states   stateSet   // to start walking root with
+	paths    []string   // to stat, instead of walking root
 }
 
 func multiglobWorker(ctx context.Context, cfg *globConfig, workCh <-chan multiglobWork) error {
 	for {
 		var root string
 		var patterns []*Pattern
+		var states stateSet
 
 		select {
 		case work, open := <-workCh:
 			if !open {
 				return nil
 			}
-			root, patterns = work.root, work.patterns
+			if work.paths != nil {
+				if err := statPaths(ctx, cfg, work.paths); err != nil {
+					return err
+				}
+				continue
+			}
+			root, patterns, states = work.root, work.patterns, work.states
 
 		case <-ctx.Done():
 			return ctx.Err()
@@ -110,33 +154,35 @@ func multiglobWorker(ctx context.Context, cfg *globConfig, workCh <-chan multigl
 			osRoot = filepath.FromSlash(root)
 		}
 
-		// Accumulate all the initial states for the patterns in the group.
 		// Invoke the callback for any patterns that are fully specified.
-		states := make(map[*state]struct{})
 		for _, p := range patterns {
-			if p.initial == nil {
-				if cfg.filesystem == nil {
-					// The fastest way to stat the file is... to stat the file.
-					fi, err := os.Stat(osRoot)
-					if err := cfg.callback(osRoot, fs.FileInfoToDirEntry(fi), err); err != nil {
-						if errors.Is(err, fs.SkipDir) || errors.Is(err, fs.SkipAll) {
-							return nil
-						}
-						return err
+			if cfg.filesystem == nil {
+				// The fastest way to stat the file is... to stat the file.
+				fi, err := os.Stat(osRoot)
+				if err == nil && !fi.IsDir() && strings.HasSuffix(p.root, "/") {
+					// The pattern ends with /, so only matches a directory.
+					continue
+				}
+				if err := cfg.callback(osRoot, fs.FileInfoToDirEntry(fi), err); err != nil {
+					if errors.Is(err, fs.SkipDir) || errors.Is(err, fs.SkipAll) {
+						return nil
 					}
-				} else {
-					// Assume root sits at that path within the provided [fs.FS].
-					fi, err := fs.Stat(cfg.filesystem, root)
-					if err := cfg.callback(osRoot, fs.FileInfoToDirEntry(fi), err); err != nil {
-						if errors.Is(err, fs.SkipDir) || errors.Is(err, fs.SkipAll) {
-							return nil
-						}
-						return err
+					return err
+				}
+			} else {
+				// Assume root sits at that path within the provided [fs.FS].
+				fi, err := fs.Stat(cfg.filesystem, root)
+				if err == nil && !fi.IsDir() && strings.HasSuffix(p.root, "/") {
+					// The pattern ends with /, so only matches a directory.
+					continue
+				}
+				if err := cfg.callback(osRoot, fs.FileInfoToDirEntry(fi), err); err != nil {
+					if errors.Is(err, fs.SkipDir) || errors.Is(err, fs.SkipAll) {
+						return nil
 					}
+					return err
 				}
-				continue
 			}
-			states[p.initial] = struct{}{}
 		}
 
 		gs := globState{
@@ -160,7 +206,13 @@ func multiglobWorker(ctx context.Context, cfg *globConfig, workCh <-chan multigl
 		}
 
 		gs.logf("starting walk in fsys %v, root %q at . with %d states\n", gs.fs, root, len(gs.states))
-		if err := fs.WalkDir(gs.fs, ".", func(path string, d fs.DirEntry, err error) error {
+		if cfg.parallelism > 1 {
+			if err := gs.walkParallel(ctx); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := gs.walk(func(path string, d fs.DirEntry, err error) error {
 			// Check that work isn't cancelled yet
 			if err := ctx.Err(); err != nil {
 				return err
@@ -137,6 +137,10 @@ func TestMultiGlob_MultiplePatterns_SameRoot(t *testing.T) {
 		t.Fatalf("MultiGlob(...) = %v", err)
 	}
 
+	// The roots (fixtures/a/b/cid and fixtures/a/b/cod) are walked
+	// concurrently.
+	got.sortCalls()
+
 	want := walkFuncCalls{
 		calls: []walkFuncArgs{
 			{Path: "fixtures/a/b/cid/erf/h/k/m"},
@@ -310,3 +314,31 @@ func TestMultiGlob_SpecificPath_WithFilesystem(t *testing.T) {
 		t.Errorf("walked paths diff (-got +want):\n%s", diff)
 	}
 }
+
+func TestMultiGlob_TrailingSlash(t *testing.T) {
+	patterns := mustMultiParse(t,
+		"fixtures/a/b/c*d/",
+		"fixtures/a/b/cad/m/",
+		"fixtures/a/b/cid/erf/",
+	)
+
+	var got walkFuncCalls
+	if err := MultiGlob(context.Background(), patterns, got.walkFunc, traceLogOpt); err != nil {
+		t.Fatalf("MultiGlob(...) = %v", err)
+	}
+	got.sortCalls()
+
+	want := walkFuncCalls{
+		calls: []walkFuncArgs{
+			{Path: "fixtures/a/b/cad"},
+			{Path: "fixtures/a/b/cd"},
+			{Path: "fixtures/a/b/cid"},
+			{Path: "fixtures/a/b/cid/erf"},
+			{Path: "fixtures/a/b/cod"},
+		},
+	}
+
+	if diff := cmp.Diff(got.calls, want.calls); diff != "" {
+		t.Errorf("walked paths diff (-got +want):\n%s", diff)
+	}
+}
@@ -0,0 +1,370 @@
+package zzglob
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"math/bits"
+	"strconv"
+	"strings"
+)
+
+// appendNumbers appends to from an automaton matching the decimal
+// representations of the integers v where lo <= v <= hi and v ≡ r (mod m).
+// Representations are zero-padded to width runes (including any - sign),
+// or are not padded if width is 0. It returns the state at the end of the
+// automaton.
+//
+// Rather than enumerating every number (which could require a vast number of
+// states and edges), the automaton is built digit-by-digit, tracking whether
+// the digits so far are tight against the lower and upper bounds (and the
+// remainder so far), so that e.g. 000-999 needs only three edges.
+func appendNumbers(from *state, lo, hi int64, m, r uint64, width int) *state {
+	end := &state{}
+
+	// Non-negative values
+	if hi >= 0 {
+		appendUnsigned(from, end, uint64(max(lo, 0)), uint64(hi), m, r, width)
+	}
+
+	// Negative values: "-" followed by the magnitude u = -v.
+	// Note that u ≡ -r (mod m).
+	if lo < 0 {
+		neg := &state{}
+		from.Out = append(from.Out, edge{Expr: literalExp('-'), State: neg})
+		appendUnsigned(neg, end, absInt(min(hi, -1)), absInt(lo), m, (m-r%m)%m, max(width-1, 0))
+	}
+
+	return end
+}
+
+// appendUnsigned is appendNumbers for non-negative numbers. All the paths it
+// adds finish at end.
+func appendUnsigned(from, end *state, lo, hi uint64, m, r uint64, width int) {
+	// Each length of representation is handled separately.
+	// low is the smallest value with an n-digit representation (unpadded).
+	var low uint64
+	for n := 1; n <= 20; n++ {
+		high := uint64(math.MaxUint64)
+		if n < 20 {
+			high = pow10(n) - 1
+		}
+		if n >= width {
+			a := low
+			if n == width {
+				// Smaller values are padded to this width.
+				a = 0
+			}
+			a, b := max(a, lo), min(high, hi)
+			if a <= b {
+				as := fmt.Sprintf("%0*d", n, a)
+				bs := fmt.Sprintf("%0*d", n, b)
+				if st := fixedWidthDigits(end, as, bs, m, r); st != nil {
+					from.Out = append(from.Out, edge{Expr: nil, State: st})
+				}
+			}
+		}
+		if n >= width && high >= hi {
+			return
+		}
+		low = high + 1
+	}
+}
+
+// pow10 returns 10^n.
+func pow10(n int) uint64 {
+	p := uint64(1)
+	for i := 0; i < n; i++ {
+		p *= 10
+	}
+	return p
+}
+
+// fixedWidthDigits returns an automaton that matches strings of exactly
+// len(a) decimal digits, whose value v satisfies a <= v <= b (a and b have
+// the same length) and v ≡ r (mod m). All paths finish at end. It returns nil
+// if there are no such strings.
+func fixedWidthDigits(end *state, a, b string, m, r uint64) *state {
+	type key struct {
+		pos        int
+		tight, thi bool // tight against a, b respectively
+		rem        uint64
+	}
+	memo := make(map[key]*state)
+
+	var build func(k key) *state
+	build = func(k key) *state {
+		if k.pos == len(a) {
+			if k.rem == r%m {
+				return end
+			}
+			return nil
+		}
+		// Being tight against 000... or 999... is no constraint at all.
+		// Normalising these makes for fewer distinct states.
+		if k.tight && strings.Trim(a[k.pos:], "0") == "" {
+			k.tight = false
+		}
+		if k.thi && strings.Trim(b[k.pos:], "9") == "" {
+			k.thi = false
+		}
+		if s, ok := memo[k]; ok {
+			return s
+		}
+
+		dlo, dhi := rune('0'), rune('9')
+		if k.tight {
+			dlo = rune(a[k.pos])
+		}
+		if k.thi {
+			dhi = rune(b[k.pos])
+		}
+
+		s := &state{}
+		lastLo := rune(-1)
+		for d := dlo; d <= dhi; d++ {
+			next := build(key{
+				pos:   k.pos + 1,
+				tight: k.tight && d == dlo,
+				thi:   k.thi && d == dhi,
+				rem:   mulAddMod(k.rem, uint64(d-'0'), m),
+			})
+			if next == nil {
+				lastLo = -1
+				continue
+			}
+			// Extend the previous edge if it is for the previous digit and
+			// goes to the same place.
+			if n := len(s.Out); lastLo >= 0 && s.Out[n-1].State == next {
+				s.Out[n-1].Expr = rangeExp{lastLo, d}.exp()
+				continue
+			}
+			s.Out = append(s.Out, edge{Expr: literalExp(d), State: next})
+			lastLo = d
+		}
+		if len(s.Out) == 0 {
+			s = nil
+		}
+		memo[k] = s
+		return s
+	}
+
+	return build(key{pos: 0, tight: true, thi: true, rem: 0})
+}
+
+// mulAddMod returns (x*10 + d) mod m, without overflowing.
+func mulAddMod(x, d, m uint64) uint64 {
+	if m == 1 {
+		return 0
+	}
+	hi, lo := bits.Mul64(x, 10)
+	lo, carry := bits.Add64(lo, d, 0)
+	_, rem := bits.Div64(hi+carry, lo, m)
+	return rem
+}
+
+// appendAtLeast appends to from an automaton matching the decimal
+// representations (without leading zeros) of every integer v >= lo. All the
+// paths it adds finish at end.
+func appendAtLeast(from, end *state, lo uint64) {
+	// Numbers with the same number of digits as lo, that are at least lo.
+	n := len(strconv.FormatUint(lo, 10))
+	high := uint64(math.MaxUint64)
+	if n < 20 {
+		high = pow10(n) - 1
+	}
+	appendUnsigned(from, end, lo, high, 1, 0, 0)
+
+	// Numbers with more digits: [1-9][0-9]{n}[0-9]*
+	s := &state{}
+	from.Out = append(from.Out, edge{Expr: rangeExp{'1', '9'}, State: s})
+	for i := 0; i < n; i++ {
+		next := &state{}
+		s.Out = append(s.Out, edge{Expr: rangeExp{'0', '9'}, State: next})
+		s = next
+	}
+	s.Out = append(s.Out,
+		edge{Expr: rangeExp{'0', '9'}, State: s},
+		edge{Expr: nil, State: end},
+	)
+}
+
+// parseNumericRange parses a zsh-style numeric range, e.g. <1-100>, <5->, or
+// <->. tks should start with the first token following <.
+//
+// The range is implemented as an automaton that tracks whether the digits so
+// far are tight against the bounds (see fixedWidthDigits), preceded by a loop
+// that consumes any leading zeros.
+func parseNumericRange(tks *tokens, from *state) (*state, error) {
+	var bounds [2]string
+	for i := 0; ; {
+		t, ok := tks.next()
+		if !ok {
+			return nil, errors.New("unterminated numeric range - missing >")
+		}
+		switch {
+		case t >= 0:
+			bounds[i] += string(rune(t))
+			continue
+		case t == tokenDash && i == 0:
+			i++
+			continue
+		case t == tokenCloseNumericRange && i == 1:
+		default:
+			return nil, fmt.Errorf("invalid %s (%d) within numeric range", t, t)
+		}
+		break
+	}
+
+	var lo, hi uint64
+	if bounds[0] != "" {
+		x, err := strconv.ParseUint(bounds[0], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid numeric range start %q: %w", bounds[0], err)
+		}
+		lo = x
+	}
+	if bounds[1] != "" {
+		x, err := strconv.ParseUint(bounds[1], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid numeric range end %q: %w", bounds[1], err)
+		}
+		hi = x
+		if hi < lo {
+			return nil, fmt.Errorf("invalid numeric range <%s-%s> - start is after end", bounds[0], bounds[1])
+		}
+	}
+
+	// Leading zeros
+	zeros := &state{}
+	from.Out = append(from.Out, edge{Expr: nil, State: zeros})
+	zeros.Out = append(zeros.Out, edge{Expr: literalExp('0'), State: zeros})
+
+	end := &state{}
+	if bounds[1] == "" {
+		appendAtLeast(zeros, end, lo)
+	} else {
+		appendUnsigned(zeros, end, lo, hi, 1, 0, 0)
+	}
+	return end, nil
+}
+
+// parseBraceSequence parses a sequence expression, e.g. {1..10}, {01..20..2},
+// or {a..f}. tks should start with the first token following {, and from is
+// the state to append the automaton to.
+func parseBraceSequence(tks *tokens, from *state) (*state, error) {
+	var parts []string
+	var cur []rune
+	for {
+		t, ok := tks.next()
+		if !ok {
+			return nil, errors.New("unterminated sequence - missing closing brace")
+		}
+		if t >= 0 {
+			cur = append(cur, rune(t))
+			continue
+		}
+		parts = append(parts, string(cur))
+		cur = nil
+		if t == tokenCloseBrace {
+			break
+		}
+		if t != tokenDotDot {
+			return nil, fmt.Errorf("invalid %s (%d) within sequence", t, t)
+		}
+	}
+	if len(parts) < 2 || len(parts) > 3 {
+		return nil, fmt.Errorf("invalid sequence with %d parts", len(parts))
+	}
+
+	step := int64(1)
+	if len(parts) == 3 {
+		s, err := strconv.ParseInt(parts[2], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid sequence step %q: %w", parts[2], err)
+		}
+		step = s
+	}
+	// Like Bash, the sign of the step doesn't matter, and 0 means 1.
+	var m uint64
+	switch {
+	case step == 0:
+		m = 1
+	default:
+		m = absInt(step)
+	}
+
+	// Letter sequence?
+	x, y := []rune(parts[0]), []rune(parts[1])
+	if len(x) == 1 && len(y) == 1 && !isDigit(x[0]) && !isDigit(y[0]) {
+		lo, hi := min(x[0], y[0]), max(x[0], y[0])
+		end := &state{}
+		if m == 1 {
+			from.Out = append(from.Out, edge{Expr: rangeExp{lo, hi}.exp(), State: end})
+			return end, nil
+		}
+		if m > uint64(hi-lo) {
+			// Only the start is a member.
+			from.Out = append(from.Out, edge{Expr: literalExp(x[0]), State: end})
+			return end, nil
+		}
+		// Bash counts from the start, so the members depend on which end is
+		// the start.
+		d := int64(m)
+		if x[0] > y[0] {
+			d = -d
+		}
+		for c := int64(x[0]); int64(lo) <= c && c <= int64(hi); c += d {
+			from.Out = append(from.Out, edge{Expr: literalExp(c), State: end})
+		}
+		return end, nil
+	}
+
+	// Integer sequence.
+	start, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid sequence start %q: %w", parts[0], err)
+	}
+	stop, err := strconv.ParseInt(parts[1], 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid sequence end %q: %w", parts[1], err)
+	}
+
+	// Like Bash, if either end has a leading zero, the members are
+	// zero-padded to the same width.
+	width := 0
+	if hasLeadingZero(parts[0]) || hasLeadingZero(parts[1]) {
+		width = max(len(parts[0]), len(parts[1]))
+	}
+
+	// The members are the numbers from start to stop (inclusive), that are
+	// a multiple of the step away from start. So they are congruent to
+	// start, modulo the step.
+	return appendNumbers(from, min(start, stop), max(start, stop), m, modInt(start, m), width), nil
+}
+
+// absInt returns |x| (without overflowing for math.MinInt64).
+func absInt(x int64) uint64 {
+	if x >= 0 {
+		return uint64(x)
+	}
+	return uint64(-(x + 1)) + 1
+}
+
+// modInt returns x mod m, in the range [0, m).
+func modInt(x int64, m uint64) uint64 {
+	if x >= 0 {
+		return uint64(x) % m
+	}
+	return (m - absInt(x)%m) % m
+}
+
+func isDigit(r rune) bool { return '0' <= r && r <= '9' }
+
+// hasLeadingZero reports whether an integer has a superfluous leading zero.
+func hasLeadingZero(s string) bool {
+	if s != "" && s[0] == '-' {
+		s = s[1:]
+	}
+	return len(s) > 1 && s[0] == '0'
+}
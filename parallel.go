@@ -0,0 +1,525 @@
+package zzglob
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"path"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// walkParallel is like gs.walk(gs.walkDirFunc), but directories are read by
+// cfg.parallelism worker goroutines. Each worker takes directories to read
+// from the end of its own queue (so it tends to go deep first), and when that
+// is empty, steals from the start of another worker's queue.
+//
+// Only directories that the states could match within are read, exactly as
+// when walking sequentially. The callback is never called concurrently.
+// Without cfg.preserveOrder, it is called by whichever worker read the
+// directory, as soon as the directory has been read. With cfg.preserveOrder,
+// the calling goroutine delivers the results of each directory in the same
+// order as fs.WalkDir, waiting for workers to read each directory in turn.
+// Workers only read ahead of the callback by up to maxReadAhead directories
+// per worker, so that a slow callback doesn't mean the whole tree is held in
+// memory.
+func (gs *globState) walkParallel(ctx context.Context) error {
+	pw := &parallelWalk{
+		ctx:         ctx,
+		ordered:     gs.cfg.preserveOrder,
+		queues:      make([][]*walkJob, gs.cfg.parallelism),
+		maxBuffered: maxReadAhead * gs.cfg.parallelism,
+	}
+	pw.cond = sync.NewCond(&pw.mu)
+	root := newWalkJob(gs, ".", nil, gs.states, nil)
+
+	var wg sync.WaitGroup
+	for i := range pw.queues {
+		wg.Add(1)
+		go func(id int) {
+			defer wg.Done()
+			pw.worker(id)
+		}(i)
+	}
+
+	if !pw.ordered {
+		pw.push(0, root)
+		wg.Wait()
+		return pw.err
+	}
+
+	if !gs.cfg.walkIntermediateDirs {
+		pw.push(0, root)
+	}
+	err := pw.deliver(root)
+	pw.stop(nil)
+	wg.Wait()
+	if err == fs.SkipDir || err == fs.SkipAll {
+		return nil
+	}
+	return err
+}
+
+// maxReadAhead limits how many directories each worker can have read (or be
+// reading) ahead of the callback, with preserveOrder.
+const maxReadAhead = 2
+
+// walkJob is a directory to read during a parallel walk.
+type walkJob struct {
+	gs     *globState // the walk the directory is in (symlinks start new ones)
+	name   string     // relative to gs.fs
+	d      fs.DirEntry
+	states stateSet // reached by matching name, including the trailing /
+
+	parent       *walkJob
+	parentStates stateSet    // reached by matching the parent directory
+	skipped      atomic.Bool // set when the callback skips the directory
+	queued       bool        // whether the job has been pushed
+	needed       bool        // being waited for by deliver (guarded by pw.mu)
+
+	// With preserveOrder, these track the job's place in pw.buffered.
+	finished atomic.Bool // set by the worker, after setting the fields below
+	released atomic.Bool // set once the job no longer counts as buffered
+
+	// These are set by the worker that reads the directory, before closing
+	// done.
+	done    chan struct{}
+	statErr error // for the root of a walk
+	readErr error
+	err     error // stops the whole walk
+	entries []walkEntry
+}
+
+// walkEntry is a directory entry that has been read and planned.
+type walkEntry struct {
+	plan  *walkPlan
+	isDir bool
+	child *walkJob // the directory to read next, if the callback agrees
+}
+
+func newWalkJob(gs *globState, name string, d fs.DirEntry, states stateSet, parent *walkJob) *walkJob {
+	return &walkJob{
+		gs:     gs,
+		name:   name,
+		d:      d,
+		states: states,
+		parent: parent,
+		done:   make(chan struct{}),
+	}
+}
+
+// isRoot reports whether the job is for the root of a walk (either the
+// root of the glob, or a symlinked directory).
+func (j *walkJob) isRoot() bool { return j.name == "." }
+
+// isSkipped reports whether the directory, or any directory containing it,
+// has been skipped by the callback.
+func (j *walkJob) isSkipped() bool {
+	for ; j != nil; j = j.parent {
+		if j.skipped.Load() {
+			return true
+		}
+	}
+	return false
+}
+
+// reportReadErr passes the error from reading the directory to the callback.
+func (j *walkJob) reportReadErr() error {
+	if j.isRoot() {
+		return j.gs.walkRoot(j.d, j.readErr)
+	}
+	return j.gs.report(j.gs.plan(j.name, j.d, j.readErr, j.parentStates))
+}
+
+// parallelWalk holds the shared state of the workers for walkParallel.
+type parallelWalk struct {
+	ctx     context.Context
+	ordered bool
+
+	// callMu serialises calls to the callback (without preserveOrder).
+	callMu sync.Mutex
+
+	mu      sync.Mutex
+	cond    *sync.Cond
+	queues  [][]*walkJob // one per worker
+	pending int          // jobs queued or being read
+	stopped bool
+	err     error // the first error that stopped the walk
+
+	// With preserveOrder, buffered counts the jobs that have been taken, but
+	// not yet delivered (or discarded). Once it reaches maxBuffered, only
+	// needed jobs are taken.
+	buffered    int
+	maxBuffered int
+}
+
+// push adds a job to the end of a worker's queue.
+func (pw *parallelWalk) push(id int, job *walkJob) {
+	job.queued = true
+	pw.mu.Lock()
+	pw.queues[id] = append(pw.queues[id], job)
+	pw.pending++
+	pw.mu.Unlock()
+	pw.cond.Signal()
+}
+
+// take removes a job from the end of the worker's queue, or failing that,
+// steals one from the start of another worker's queue. It waits for a job
+// if there are none, and returns nil once the walk is over. With
+// preserveOrder, once too many jobs are buffered, it waits for a needed job.
+func (pw *parallelWalk) take(id int) *walkJob {
+	pw.mu.Lock()
+	defer pw.mu.Unlock()
+	for {
+		if pw.stopped {
+			return nil
+		}
+		var job *walkJob
+		if pw.ordered && pw.buffered >= pw.maxBuffered {
+			job = pw.takeNeeded()
+		} else {
+			job = pw.takeAny(id)
+		}
+		if job != nil {
+			if pw.ordered {
+				pw.buffered++
+			}
+			return job
+		}
+		if pw.pending == 0 && !pw.ordered {
+			// Nothing queued, and nothing being read that could queue more.
+			return nil
+		}
+		pw.cond.Wait()
+	}
+}
+
+// takeAny removes a job from the end of the worker's queue, or the start of
+// another's, or returns nil if there are none. pw.mu must be held.
+func (pw *parallelWalk) takeAny(id int) *walkJob {
+	if q := pw.queues[id]; len(q) > 0 {
+		job := q[len(q)-1]
+		pw.queues[id] = q[:len(q)-1]
+		return job
+	}
+	for i := 1; i < len(pw.queues); i++ {
+		victim := (id + i) % len(pw.queues)
+		if q := pw.queues[victim]; len(q) > 0 {
+			job := q[0]
+			pw.queues[victim] = q[1:]
+			return job
+		}
+	}
+	return nil
+}
+
+// takeNeeded removes the job that deliver is waiting for from whichever
+// queue it is in, or returns nil if it isn't queued. pw.mu must be held.
+func (pw *parallelWalk) takeNeeded() *walkJob {
+	for id, q := range pw.queues {
+		for i, job := range q {
+			if job.needed {
+				pw.queues[id] = slices.Delete(q, i, i+1)
+				return job
+			}
+		}
+	}
+	return nil
+}
+
+// need marks the job as needed by deliver (queueing it, if it isn't
+// already), so that it is read even if too many jobs are buffered.
+func (pw *parallelWalk) need(job *walkJob) {
+	pw.mu.Lock()
+	job.needed = true
+	if !job.queued {
+		job.queued = true
+		pw.queues[0] = append(pw.queues[0], job)
+		pw.pending++
+	}
+	pw.mu.Unlock()
+	pw.cond.Broadcast()
+}
+
+// release records that the job (which has been taken) is no longer
+// buffered, unless that has been recorded already.
+func (pw *parallelWalk) release(job *walkJob) {
+	if !job.released.CompareAndSwap(false, true) {
+		return
+	}
+	pw.mu.Lock()
+	pw.buffered--
+	pw.mu.Unlock()
+	pw.cond.Broadcast()
+}
+
+// discard releases the skipped job, and the jobs within it that have been
+// read ahead. Jobs that haven't been read yet release themselves when they
+// are (see worker), since they are then skipped.
+func (pw *parallelWalk) discard(job *walkJob) {
+	if job == nil || !job.finished.Load() {
+		return
+	}
+	pw.release(job)
+	for _, e := range job.entries {
+		pw.discard(e.child)
+	}
+}
+
+// finish records that a job taken from a queue is finished.
+func (pw *parallelWalk) finish() {
+	pw.mu.Lock()
+	pw.pending--
+	if pw.pending == 0 {
+		pw.cond.Broadcast()
+	}
+	pw.mu.Unlock()
+}
+
+// stop stops the walk. The first non-nil error (other than fs.SkipAll) is
+// returned by walkParallel.
+func (pw *parallelWalk) stop(err error) {
+	if err == fs.SkipAll {
+		err = nil
+	}
+	pw.mu.Lock()
+	if !pw.stopped {
+		pw.stopped, pw.err = true, err
+	}
+	pw.mu.Unlock()
+	pw.cond.Broadcast()
+}
+
+func (pw *parallelWalk) isStopped() bool {
+	pw.mu.Lock()
+	defer pw.mu.Unlock()
+	return pw.stopped
+}
+
+func (pw *parallelWalk) worker(id int) {
+	for {
+		job := pw.take(id)
+		if job == nil {
+			return
+		}
+		if pw.ordered {
+			pw.read(id, job)
+			job.finished.Store(true)
+			close(job.done)
+			if job.isSkipped() {
+				// Skipped before (or while) being read, so it will never be
+				// delivered.
+				pw.discard(job)
+			}
+		} else {
+			pw.walkDir(id, job)
+		}
+		pw.finish()
+	}
+}
+
+// statRoot stats the root of the walk for the job.
+func (j *walkJob) statRoot() {
+	if j.gs.depth > globSymlinkRecursionLimit {
+		j.err = fmt.Errorf("recursion limit %d reached; possible symlink cycle", globSymlinkRecursionLimit)
+		return
+	}
+	info, err := fs.Stat(j.gs.fs, ".")
+	if err != nil {
+		j.statErr = err
+		return
+	}
+	j.d = fs.FileInfoToDirEntry(info)
+}
+
+// read reads and plans the directory for the job. With preserveOrder, any
+// subdirectory that won't be passed to the callback before being read (so
+// the callback can't skip it) is queued straight away.
+func (pw *parallelWalk) read(id int, job *walkJob) {
+	if pw.ordered && job.isSkipped() {
+		return
+	}
+	gs := job.gs
+	if job.isRoot() {
+		if job.d == nil {
+			job.statRoot()
+		}
+		if job.d == nil || !job.d.IsDir() {
+			return
+		}
+	}
+	if strings.Count(job.name, "/") > globSymlinkRecursionLimit {
+		// Only possible by following symlinks.
+		job.err = fmt.Errorf("recursion limit %d reached; possible symlink cycle", globSymlinkRecursionLimit)
+		return
+	}
+
+	entries, err := gs.readDirFrom(job.name, job.states)
+	job.readErr = err
+	job.entries = make([]walkEntry, 0, len(entries))
+	for _, d := range entries {
+		fp := path.Join(job.name, d.Name())
+		v := gs.plan(fp, d, nil, job.states)
+		e := walkEntry{plan: v, isDir: d.IsDir()}
+		switch {
+		case v.outcome == outcomeLink:
+			e.child = newWalkJob(v.link, ".", nil, v.link.states, job)
+		case d.IsDir() && v.outcome == outcomeContinue && len(v.states) > 0:
+			e.child = newWalkJob(gs, fp, d, v.states, job)
+			e.child.parentStates = job.states
+		}
+		if pw.ordered && e.child != nil && !v.report && !(e.child.isRoot() && gs.cfg.walkIntermediateDirs) {
+			pw.push(id, e.child)
+		}
+		job.entries = append(job.entries, e)
+	}
+}
+
+// call calls fn (which calls the callback), unless the walk has stopped.
+// Errors from the callback, other than fs.SkipDir, stop the walk.
+func (pw *parallelWalk) call(fn func() error) error {
+	pw.callMu.Lock()
+	defer pw.callMu.Unlock()
+	if pw.isStopped() {
+		return fs.SkipAll
+	}
+	if err := pw.ctx.Err(); err != nil {
+		pw.stop(err)
+		return err
+	}
+	err := fn()
+	if err != nil && err != fs.SkipDir {
+		pw.stop(err)
+	}
+	return err
+}
+
+// walkDir reads the directory for the job, passes what it finds to the
+// callback, and queues subdirectories to be read (without preserveOrder).
+func (pw *parallelWalk) walkDir(id int, job *walkJob) {
+	gs := job.gs
+	if job.isRoot() {
+		// The root is passed to the callback before reading it.
+		job.statRoot()
+		if job.err != nil {
+			pw.stop(job.err)
+			return
+		}
+		d, statErr := job.d, job.statErr
+		if err := pw.call(func() error { return gs.walkRoot(d, statErr) }); err != nil || statErr != nil {
+			return
+		}
+		if !job.d.IsDir() {
+			return
+		}
+	}
+	pw.read(id, job)
+	if job.err != nil {
+		pw.stop(job.err)
+		return
+	}
+	if job.readErr != nil {
+		if err := pw.call(job.reportReadErr); err != nil {
+			return
+		}
+	}
+	for _, e := range job.entries {
+		err := pw.call(func() error { return gs.report(e.plan) })
+		if err == fs.SkipDir && e.isDir {
+			continue
+		}
+		if err != nil {
+			// fs.SkipDir from a non-directory skips the rest of the
+			// directory.
+			return
+		}
+		if e.child != nil {
+			pw.push(id, e.child)
+		}
+	}
+}
+
+// deliver passes the results of reading the directory for the job, and
+// everything within it, to the callback in the same order as fs.WalkDir (with
+// preserveOrder). It returns nil if the callback skips the directory.
+func (pw *parallelWalk) deliver(job *walkJob) error {
+	gs := job.gs
+	if job.isRoot() && gs.cfg.walkIntermediateDirs {
+		// The root is passed to the callback before reading it.
+		job.statRoot()
+		if job.err != nil {
+			return job.err
+		}
+		if job.statErr != nil {
+			return skipDirOK(gs.walkRoot(nil, job.statErr))
+		}
+		if err := gs.walkRoot(job.d, nil); err != nil || !job.d.IsDir() {
+			return skipDirOK(err)
+		}
+	}
+	pw.need(job)
+	select {
+	case <-job.done:
+	case <-pw.ctx.Done():
+		return pw.ctx.Err()
+	}
+	// The entries are now held by deliver, rather than buffered.
+	pw.release(job)
+	if job.err != nil {
+		return job.err
+	}
+	if job.statErr != nil {
+		return skipDirOK(gs.walkRoot(nil, job.statErr))
+	}
+	if job.readErr != nil {
+		if err := job.reportReadErr(); err != nil {
+			return skipDirOK(err)
+		}
+	}
+
+	entries := job.entries
+	job.entries = nil
+	for i, e := range entries {
+		if err := pw.ctx.Err(); err != nil {
+			return err
+		}
+		err := gs.report(e.plan)
+		if err == nil && e.child != nil {
+			err = pw.deliver(e.child)
+		}
+		if err == fs.SkipDir && e.isDir {
+			pw.skip(e.child)
+			continue
+		}
+		if err == fs.SkipDir {
+			// Skip the rest of the directory.
+			for _, e := range entries[i+1:] {
+				pw.skip(e.child)
+			}
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// skip marks the directory (if any) as skipped, so that it isn't read, and
+// discards it if it has been read already.
+func (pw *parallelWalk) skip(j *walkJob) {
+	if j != nil {
+		j.skipped.Store(true)
+		pw.discard(j)
+	}
+}
+
+// skipDirOK returns nil if err is fs.SkipDir, otherwise err.
+func skipDirOK(err error) error {
+	if err == fs.SkipDir {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,232 @@
+package zzglob
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestGlob_ParallelAgreesWithSequential(t *testing.T) {
+	tests := []struct {
+		pattern string
+		opts    []GlobOption
+	}{
+		{pattern: "src/**/*_test.go"},
+		{pattern: "src/d0/**/d1/*.go"},
+		{pattern: "**/d1/d?/README"},
+		{pattern: "src/*/d2/**"},
+		{pattern: "src/{d0,d2}/*/{a.go,README}"},
+		{pattern: "src/**/d1/", opts: []GlobOption{WalkIntermediateDirs(true)}},
+		{pattern: "src/d1/**/*.go", opts: []GlobOption{TraverseSymlinks(false)}},
+	}
+
+	for _, test := range tests {
+		p := MustParse(test.pattern)
+
+		seqFS := &readDirRecorder{FS: deepMapFS(4, 3)}
+		var want walkFuncCalls
+		opts := append([]GlobOption{traceLogOpt, WithFilesystem(seqFS)}, test.opts...)
+		if err := p.Glob(want.walkFunc, opts...); err != nil {
+			t.Fatalf("Glob(%q) = %v", test.pattern, err)
+		}
+		if len(want.calls) == 0 {
+			t.Errorf("%q matches nothing in the test filesystem", test.pattern)
+		}
+		sort.Strings(seqFS.reads)
+
+		for _, ordered := range []bool{false, true} {
+			parFS := &readDirRecorder{FS: deepMapFS(4, 3)}
+			var got walkFuncCalls
+			opts := append([]GlobOption{traceLogOpt, WithFilesystem(parFS), Parallelism(4), PreserveOrder(ordered)}, test.opts...)
+			if err := p.Glob(got.walkFunc, opts...); err != nil {
+				t.Fatalf("Glob(%q, Parallelism(4), PreserveOrder(%t)) = %v", test.pattern, ordered, err)
+			}
+			want := want.calls
+			if !ordered {
+				// Sort both, to compare the results as sets.
+				got.sortCalls()
+				want = append([]walkFuncArgs(nil), want...)
+				sort.Slice(want, func(i, j int) bool { return want[i].Path < want[j].Path })
+			}
+			if diff := cmp.Diff(got.calls, want); diff != "" {
+				t.Errorf("%q PreserveOrder(%t) walked paths diff (-got +want):\n%s", test.pattern, ordered, diff)
+			}
+
+			// The same directories are pruned.
+			sort.Strings(parFS.reads)
+			if diff := cmp.Diff(parFS.reads, seqFS.reads); diff != "" {
+				t.Errorf("%q PreserveOrder(%t) read directories diff (-got +want):\n%s", test.pattern, ordered, diff)
+			}
+		}
+	}
+}
+
+func TestGlob_ParallelFixtures(t *testing.T) {
+	// The fixtures include symlinks to directories, and a broken symlink.
+	for _, pattern := range []string{
+		"fixtures/a/b/c*d/e?f/[ghi]/{j,k,l}/**/m",
+		"fixtures/**/*_spec.rb",
+		"fixtures/**",
+	} {
+		p := MustParse(pattern)
+		var want walkFuncCalls
+		if err := p.Glob(want.walkFunc, traceLogOpt); err != nil {
+			t.Fatalf("Glob(%q) = %v", pattern, err)
+		}
+
+		var ordered walkFuncCalls
+		if err := p.Glob(ordered.walkFunc, traceLogOpt, Parallelism(3), PreserveOrder(true)); err != nil {
+			t.Fatalf("Glob(%q, Parallelism(3), PreserveOrder(true)) = %v", pattern, err)
+		}
+		if diff := cmp.Diff(ordered.calls, want.calls); diff != "" {
+			t.Errorf("%q PreserveOrder(true) walked paths diff (-got +want):\n%s", pattern, diff)
+		}
+
+		var unordered walkFuncCalls
+		if err := p.Glob(unordered.walkFunc, traceLogOpt, Parallelism(3)); err != nil {
+			t.Fatalf("Glob(%q, Parallelism(3)) = %v", pattern, err)
+		}
+		unordered.sortCalls()
+		want.sortCalls()
+		if diff := cmp.Diff(unordered.calls, want.calls); diff != "" {
+			t.Errorf("%q walked paths diff (-got +want):\n%s", pattern, diff)
+		}
+	}
+}
+
+func TestGlob_ParallelSkipDir(t *testing.T) {
+	p := MustParse("src/**/a.go")
+	for _, ordered := range []bool{false, true} {
+		fsys := &readDirRecorder{FS: deepMapFS(3, 3)}
+		var got []string
+		err := p.Glob(func(path string, d fs.DirEntry, err error) error {
+			// Never called concurrently.
+			got = append(got, path)
+			if path == "src/d1" {
+				return fs.SkipDir
+			}
+			return nil
+		}, traceLogOpt, WithFilesystem(fsys), WalkIntermediateDirs(true), Parallelism(4), PreserveOrder(ordered))
+		if err != nil {
+			t.Fatalf("Glob(..., PreserveOrder(%t)) = %v", ordered, err)
+		}
+
+		if len(got) == 0 {
+			t.Errorf("PreserveOrder(%t): callback never called", ordered)
+		}
+		for _, path := range got {
+			if strings.HasPrefix(path, "src/d1/") {
+				t.Errorf("PreserveOrder(%t): callback called with %q within skipped directory", ordered, path)
+			}
+		}
+		for _, dir := range fsys.reads {
+			if dir == "src/d1" || strings.HasPrefix(dir, "src/d1/") {
+				t.Errorf("PreserveOrder(%t): read %q within skipped directory", ordered, dir)
+			}
+		}
+	}
+}
+
+func TestGlob_ParallelStops(t *testing.T) {
+	p := MustParse("src/**/*.go")
+	errStop := errors.New("stop")
+	for _, ordered := range []bool{false, true} {
+		for _, stop := range []error{fs.SkipAll, errStop} {
+			calls := 0
+			err := p.Glob(func(string, fs.DirEntry, error) error {
+				calls++
+				if calls == 3 {
+					return stop
+				}
+				return nil
+			}, traceLogOpt, WithFilesystem(deepMapFS(4, 3)), Parallelism(4), PreserveOrder(ordered))
+
+			wantErr := stop
+			if stop == fs.SkipAll {
+				wantErr = nil
+			}
+			if err != wantErr {
+				t.Errorf("Glob(..., PreserveOrder(%t)) with callback returning %v = %v, want %v", ordered, stop, err, wantErr)
+			}
+			if calls != 3 {
+				t.Errorf("PreserveOrder(%t): callback returning %v called %d times, want 3", ordered, stop, calls)
+			}
+		}
+	}
+}
+
+func TestGlob_ParallelReadAheadLimit(t *testing.T) {
+	p := MustParse("src/**/*.go")
+	fsys := &readDirRecorder{FS: deepMapFS(4, 3)}
+	readCount := func() int {
+		fsys.mu.Lock()
+		defer fsys.mu.Unlock()
+		return len(fsys.reads)
+	}
+
+	// The callback blocks on the first match, while the workers read ahead.
+	called, unblock := make(chan struct{}), make(chan struct{})
+	var once sync.Once
+	errc := make(chan error, 1)
+	go func() {
+		errc <- p.Glob(func(string, fs.DirEntry, error) error {
+			once.Do(func() {
+				close(called)
+				<-unblock
+			})
+			return nil
+		}, traceLogOpt, WithFilesystem(fsys), Parallelism(2), PreserveOrder(true))
+	}()
+	<-called
+
+	// Wait for the workers to stop reading.
+	n := readCount()
+	for deadline := time.Now().Add(2 * time.Second); time.Now().Before(deadline); {
+		time.Sleep(20 * time.Millisecond)
+		m := readCount()
+		if m == n {
+			break
+		}
+		n = m
+	}
+	close(unblock)
+	if err := <-errc; err != nil {
+		t.Fatalf("Glob(...) = %v", err)
+	}
+
+	// src is read before the callback is first called, and then the workers
+	// can only read so far ahead.
+	if limit := 1 + maxReadAhead*2; n > limit {
+		t.Errorf("read %d directories while the callback was blocked, want at most %d", n, limit)
+	}
+	if got, want := readCount(), 1+3+9+27+81; got != want {
+		t.Errorf("read %d directories in total, want %d", got, want)
+	}
+}
+
+func TestMultiGlob_Parallel(t *testing.T) {
+	patterns := []*Pattern{
+		MustParse("src/d0/**/*_test.go"),
+		MustParse("src/d2/*/README"),
+	}
+
+	var want, got walkFuncCalls
+	if err := MultiGlob(context.Background(), patterns, want.walkFunc, traceLogOpt, WithFilesystem(deepMapFS(4, 3))); err != nil {
+		t.Fatalf("MultiGlob(...) = %v", err)
+	}
+	if err := MultiGlob(context.Background(), patterns, got.walkFunc, traceLogOpt, WithFilesystem(deepMapFS(4, 3)), Parallelism(4)); err != nil {
+		t.Fatalf("MultiGlob(..., Parallelism(4)) = %v", err)
+	}
+	want.sortCalls()
+	got.sortCalls()
+	if diff := cmp.Diff(got.calls, want.calls); diff != "" {
+		t.Errorf("walked paths diff (-got +want):\n%s", diff)
+	}
+}
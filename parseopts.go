@@ -5,25 +5,42 @@ import (
 )
 
 var defaultParseConfig = parseConfig{
-	allowEscaping:    filepath.Separator == '/',
-	allowQuestion:    true,
-	allowStar:        true,
-	allowDoubleStar:  true,
-	allowAlternation: true,
-	allowCharClass:   true,
-	swapSlashes:      filepath.Separator != '/',
-	expandTilde:      true,
+	allowEscaping:       filepath.Separator == '/',
+	allowQuestion:       true,
+	allowStar:           true,
+	allowDoubleStar:     true,
+	allowAlternation:    true,
+	allowCharClass:      true,
+	allowNamedCharClass: false,
+	matchDotfiles:       true,
+	swapSlashes:         filepath.Separator != '/',
+	expandTilde:         true,
 }
 
 type parseConfig struct {
-	allowEscaping    bool
-	allowQuestion    bool
-	allowStar        bool
-	allowDoubleStar  bool
-	allowAlternation bool
-	allowCharClass   bool
-	swapSlashes      bool
-	expandTilde      bool
+	allowEscaping          bool
+	allowQuestion          bool
+	allowStar              bool
+	allowDoubleStar        bool
+	allowAlternation       bool
+	allowCharClass         bool
+	allowNamedCharClass    bool
+	allowExtGlob           bool
+	allowBraceSequence     bool
+	allowNumericRange      bool
+	allowSegmentRepetition bool
+	caseInsensitive        bool
+	matchDotfiles          bool
+	matchBase              bool
+	swapSlashes            bool
+	expandTilde            bool
+	homeDirResolver        func(string) (string, error)
+	expandEnv              bool
+	lookupEnv              func(string) (string, bool)
+
+	// If non-nil, wildcards and alternations are tagged as capture groups,
+	// numbered by incrementing *groups. (Only used internally.)
+	groups *int
 }
 
 // ParseOption functions optionally alter how patterns are parsed.
@@ -74,6 +91,55 @@ func AllowAlternation(enable bool) ParseOption {
 	}
 }
 
+// AllowBraceSequence changes how brace sequences, such as {1..10},
+// {01..20..2}, or {a..f} are parsed, and applies only if AllowAlternation is
+// enabled (the default). If enabled, they work like Bash sequence expressions:
+// {x..y} matches any integer (or letter) from x to y inclusive, and
+// {x..y..step} matches every step-th integer (or letter) from x. If either x
+// or y has a leading zero, the integers are zero-padded to the same width
+// (so {00..15} matches 07 but not 7). If disabled, they are parsed as ordinary
+// alternations (with one alternative).
+// Disabled by default.
+func AllowBraceSequence(enable bool) ParseOption {
+	return func(o *parseConfig) {
+		o.allowBraceSequence = enable
+	}
+}
+
+// AllowNumericRange changes how zsh-style numeric ranges, such as <1-100>,
+// <5->, <-10>, or <-> are parsed. If enabled, <x-y> matches any run of
+// decimal digits with a value from x to y inclusive. Either bound can be
+// omitted, so <-> matches any run of digits. Unlike brace sequences, leading
+// zeros don't matter: frame<0-299>.png matches both frame7.png and
+// frame007.png. If disabled, < and > are treated as literals.
+// Disabled by default.
+func AllowNumericRange(enable bool) ParseOption {
+	return func(o *parseConfig) {
+		o.allowNumericRange = enable
+	}
+}
+
+// AllowSegmentRepetition changes how {n,m} is parsed immediately after a
+// path separator or **. If enabled, it repeats path segments:
+//
+//   - X/{n,m} matches n to m repetitions of the segment X/ (the part of the
+//     pattern since the previous separator), so */{1,3} matches one to three
+//     directories, each followed by a separator.
+//   - **{n,m} matches n to m path segments of any name, so
+//     src/**{0,2}/*.go matches src/a.go, src/x/a.go, and src/x/y/a.go, but
+//     not src/x/y/z/a.go.
+//
+// Either bound can be omitted ({,m} means {0,m} and {n,} has no upper bound),
+// and {n} means exactly n. When globbing, directories deeper than the upper
+// bound are not walked. If disabled, { } are parsed as usual (e.g. as an
+// alternation).
+// Disabled by default.
+func AllowSegmentRepetition(enable bool) ParseOption {
+	return func(o *parseConfig) {
+		o.allowSegmentRepetition = enable
+	}
+}
+
 // AllowCharClass changes how [ ] are parsed. If enabled, [ and ] denote
 // character classes. If disabled, [ and ] are treated as literals.
 // Enabled by default.
@@ -83,8 +149,88 @@ func AllowCharClass(enable bool) ParseOption {
 	}
 }
 
-// ExpandTilde changes how ~ is parsed. If enabled, ~ is expanded to the current
-// user's home directory. If disabled, ~ is treated as a literal.
+// AllowNamedCharClass changes how named classes within char classes are
+// parsed, and applies only if AllowCharClass is enabled (the default). If
+// enabled, POSIX classes such as [:alpha:], [:digit:], and [:space:], and
+// Unicode classes such as \p{Han}, \p{L}, and \P{L} (negated) can appear
+// within [ ] and [^ ], e.g. [[:upper:]_] or [^\p{Greek}]. POSIX classes
+// use Unicode definitions, except for [:digit:] and [:xdigit:], which are
+// ASCII-only. If disabled, they are parsed as ordinary char class contents.
+// Disabled by default.
+func AllowNamedCharClass(enable bool) ParseOption {
+	return func(o *parseConfig) {
+		o.allowNamedCharClass = enable
+	}
+}
+
+// AllowExtGlob changes how the extended glob operators ?( ), *( ), +( ),
+// @( ), and !( ) are parsed. If enabled, they work like Bash with the extglob
+// shell option set, where the operator contains one or more patterns
+// separated by |:
+//
+//   - ?(a|b) matches zero or one occurrence of the patterns.
+//   - *(a|b) matches zero or more occurrences of the patterns.
+//   - +(a|b) matches one or more occurrences of the patterns.
+//   - @(a|b) matches exactly one of the patterns.
+//   - !(a|b) matches anything within a path segment except one of the
+//     patterns. For example, !(*_test).go matches main.go, but not
+//     main_test.go.
+//
+// If disabled, the operators are treated as ordinary characters.
+// Disabled by default.
+func AllowExtGlob(enable bool) ParseOption {
+	return func(o *parseConfig) {
+		o.allowExtGlob = enable
+	}
+}
+
+// CaseInsensitive changes whether the pattern matches case-insensitively. If
+// enabled, every part of the pattern (literals, char classes, ranges, named
+// classes, and so on) matches using Unicode simple case folding (like
+// [strings.EqualFold]), so e.g. [^a-z] matches neither x nor X. When globbing,
+// the pattern root is resolved against the actual directory entries, so a
+// pattern such as "Photos/*.JPG" finds "photos/a.jpg".
+// Disabled by default.
+func CaseInsensitive(enable bool) ParseOption {
+	return func(o *parseConfig) {
+		o.caseInsensitive = enable
+	}
+}
+
+// MatchDotfiles changes whether wildcards can match a . at the start of a
+// path segment. If disabled, the pattern follows the shell convention for
+// hidden files: a leading . in a segment is only matched by an explicit .
+// in the pattern, so *, ?, **, and [^...] don't match it. For example,
+// **/*.json doesn't match .git/config.json or a/.b.json, but a/.*.json
+// matches a/.b.json. When globbing, hidden directories are not read unless
+// the pattern could match something inside them.
+// Enabled by default.
+func MatchDotfiles(enable bool) ParseOption {
+	return func(o *parseConfig) {
+		o.matchDotfiles = enable
+	}
+}
+
+// MatchBase changes how patterns without a path separator are parsed, in the
+// style of gitignore. If enabled, a pattern with no separator (other than
+// a trailing separator) matches at any depth, so *.o is equivalent to **/*.o
+// (but the pattern root is unaffected for other patterns). A pattern with a
+// leading separator is anchored to the root of the walk (the current
+// directory) instead of the filesystem root, so /*.o matches a.o but not
+// b/a.o.
+// Disabled by default.
+func MatchBase(enable bool) ParseOption {
+	return func(o *parseConfig) {
+		o.matchBase = enable
+	}
+}
+
+// ExpandTilde changes how ~ is parsed. If enabled, a ~ at the start of the
+// pattern, up to the first /, is expanded (like a shell): ~/ becomes the
+// current user's home directory, ~alice/ becomes alice's home directory, ~+/
+// becomes the current working directory, and ~-/ becomes the previous working
+// directory ($OLDPWD). If there is no / (e.g. the pattern is only ~), the
+// directory can't be determined, or if disabled, ~ is treated as a literal.
 // Enabled by default.
 func ExpandTilde(enable bool) ParseOption {
 	return func(o *parseConfig) {
@@ -92,6 +238,43 @@ func ExpandTilde(enable bool) ParseOption {
 	}
 }
 
+// WithHomeDirResolver overrides how tilde-prefixes are expanded (see
+// ExpandTilde), and applies only if ExpandTilde is enabled (the default).
+// The resolver is passed the text between the ~ and the first / (or the end
+// of the pattern): "" for the current user, "+" or "-" for the current or
+// previous working directories, or otherwise a user name. If it returns an
+// error, the ~ is treated as a literal. By default, the current user and
+// other users are looked up with the os/user package, and the working
+// directories come from os.Getwd and $OLDPWD.
+func WithHomeDirResolver(resolve func(user string) (string, error)) ParseOption {
+	return func(o *parseConfig) {
+		o.homeDirResolver = resolve
+	}
+}
+
+// ExpandEnv changes how $ is parsed. If enabled, environment variable
+// references are expanded: $VAR and ${VAR} become the value of VAR (or
+// nothing, if it is unset), and ${VAR:-default} becomes default if VAR is
+// unset or empty. The expanded text is always treated as literal, so a * in
+// the value of a variable matches only *, and a ~ in a default isn't
+// expanded. If disabled, or if $ isn't followed by a variable name, $ is
+// treated as a literal.
+// Disabled by default.
+func ExpandEnv(enable bool) ParseOption {
+	return func(o *parseConfig) {
+		o.expandEnv = enable
+	}
+}
+
+// WithEnvLookup overrides how environment variables are looked up, and
+// applies only if ExpandEnv is enabled. The function has the same meaning as
+// os.LookupEnv, which is used by default.
+func WithEnvLookup(lookup func(key string) (string, bool)) ParseOption {
+	return func(o *parseConfig) {
+		o.lookupEnv = lookup
+	}
+}
+
 // WithSwapSlashes changes how \ and / are interpreted. If enabled, / becomes the
 // escape character (which can be disabled with AllowEscaping), and \ becomes
 // the path separator (typical on Windows). Note that after parsing, the pattern
@@ -0,0 +1,288 @@
+package zzglob
+
+import (
+	"errors"
+	"fmt"
+	"regexp/syntax"
+	"strings"
+	"unicode"
+)
+
+// ParseRegexp parses a regular expression (in RE2 syntax, as accepted by
+// regexp.Compile) into a pattern. As with regexp.MatchString, the expression
+// matches a path if it matches any part of the path, so anchor it with ^ and
+// $ to match whole paths. When the expression starts with ^ and a literal
+// directory (e.g. ^src/), that directory becomes the root, where Glob starts
+// walking, and Glob skips directories within which nothing could match.
+//
+// Unlike patterns from Parse, / is not special (. and [^a] match /), capture
+// groups are ignored (MatchCaptures reports none), and multi-line anchors and
+// word boundaries are not supported.
+func ParseRegexp(expr string) (*Pattern, error) {
+	re, err := syntax.Parse(expr, syntax.Perl)
+	if err != nil {
+		var serr *syntax.Error
+		if errors.As(err, &serr) && serr.Code == syntax.ErrInvalidEscape && len(serr.Expr) == 2 && '1' <= serr.Expr[1] && serr.Expr[1] <= '9' {
+			return nil, fmt.Errorf("backreferences are not supported: %w", err)
+		}
+		return nil, err
+	}
+
+	b := &regexpBuilder{
+		begin: make(map[*state][]*state),
+		end:   make(map[*state][]*state),
+	}
+	start, end, err := b.build(re.Simplify())
+	if err != nil {
+		return nil, err
+	}
+
+	// Unanchored, so allow anything before and after.
+	initial, prefix, suffix := &state{}, &state{}, &state{Accept: true}
+	initial.Out = []edge{{State: prefix}}
+	prefix.Out = []edge{{Expr: doubleStarExp{}, State: prefix}, {State: start}}
+	end.Out = append(end.Out, edge{State: suffix})
+	suffix.Out = []edge{{Expr: doubleStarExp{}, State: suffix}}
+	b.resolveAnchors(initial)
+
+	reduce(initial)
+	trim(initial)
+
+	cfg := defaultParseConfig
+	cfg.expandTilde = false
+	root := regexpRoot(initial)
+	p := &Pattern{
+		root:         root,
+		initial:      &state{},
+		inputPattern: expr,
+		inputConfig:  cfg,
+	}
+	for s := range matchSegment(singleton(initial), root) {
+		p.initial.Out = append(p.initial.Out, edge{State: s})
+	}
+	p.dfa = newLazyDFA(p.initial)
+	return p, nil
+}
+
+// regexpBuilder builds an automaton from a regexp/syntax tree. Anchors are
+// recorded separately from the other edges, as nil edges that can only be
+// followed at the beginning (begin) or end (end) of the path, until they are
+// resolved by resolveAnchors.
+type regexpBuilder struct {
+	begin, end map[*state][]*state
+}
+
+// build returns the start and end states of a fragment matching re.
+func (b *regexpBuilder) build(re *syntax.Regexp) (start, end *state, err error) {
+	start, end = &state{}, &state{}
+	link := func(from, to *state, exprs ...expression) {
+		if len(exprs) == 0 {
+			from.Out = append(from.Out, edge{State: to})
+		}
+		for _, x := range exprs {
+			from.Out = append(from.Out, edge{Expr: x, State: to})
+		}
+	}
+
+	switch re.Op {
+	case syntax.OpNoMatch:
+		// No edges.
+
+	case syntax.OpEmptyMatch:
+		link(start, end)
+
+	case syntax.OpLiteral:
+		cur := start
+		for _, r := range re.Rune {
+			next := &state{}
+			rs := []rangeExp{{r, r}}
+			if re.Flags&syntax.FoldCase != 0 {
+				rs = foldRanges(rs)
+			}
+			link(cur, next, rangeExps(rs)...)
+			cur = next
+		}
+		link(cur, end)
+
+	case syntax.OpCharClass:
+		var rs []rangeExp
+		for i := 0; i+1 < len(re.Rune); i += 2 {
+			rs = append(rs, rangeExp{re.Rune[i], re.Rune[i+1]})
+		}
+		link(start, end, rangeExps(mergeRanges(rs))...)
+
+	case syntax.OpAnyCharNotNL:
+		link(start, end, rangeExps([]rangeExp{{0, '\n' - 1}, {'\n' + 1, unicode.MaxRune}})...)
+
+	case syntax.OpAnyChar:
+		link(start, end, doubleStarExp{})
+
+	case syntax.OpBeginText:
+		b.begin[start] = append(b.begin[start], end)
+
+	case syntax.OpEndText:
+		b.end[start] = append(b.end[start], end)
+
+	case syntax.OpBeginLine, syntax.OpEndLine:
+		return nil, nil, fmt.Errorf("multi-line anchor %v is not supported", re)
+
+	case syntax.OpWordBoundary, syntax.OpNoWordBoundary:
+		return nil, nil, fmt.Errorf("word boundary %v is not supported", re)
+
+	case syntax.OpCapture:
+		s, e, err := b.build(re.Sub[0])
+		if err != nil {
+			return nil, nil, err
+		}
+		link(start, s)
+		link(e, end)
+
+	case syntax.OpStar, syntax.OpPlus, syntax.OpQuest:
+		s, e, err := b.build(re.Sub[0])
+		if err != nil {
+			return nil, nil, err
+		}
+		link(start, s)
+		link(e, end)
+		if re.Op != syntax.OpPlus {
+			link(start, end)
+		}
+		if re.Op != syntax.OpQuest {
+			link(e, s)
+		}
+
+	case syntax.OpConcat:
+		cur := start
+		for _, sub := range re.Sub {
+			s, e, err := b.build(sub)
+			if err != nil {
+				return nil, nil, err
+			}
+			link(cur, s)
+			cur = e
+		}
+		link(cur, end)
+
+	case syntax.OpAlternate:
+		for _, sub := range re.Sub {
+			s, e, err := b.build(sub)
+			if err != nil {
+				return nil, nil, err
+			}
+			link(start, s)
+			link(e, end)
+		}
+
+	default:
+		// OpRepeat should have been removed by Simplify.
+		return nil, nil, fmt.Errorf("unsupported regexp operator %v in %v", re.Op, re)
+	}
+	return start, end, nil
+}
+
+// rangeExps converts rune ranges into expressions.
+func rangeExps(rs []rangeExp) []expression {
+	exprs := make([]expression, 0, len(rs))
+	for _, r := range rs {
+		exprs = append(exprs, r.exp())
+	}
+	return exprs
+}
+
+// resolveAnchors replaces the anchors with ordinary edges and accepting
+// states, given the initial state (which must have no edges into it). A ^
+// anchor can only be followed without consuming anything from initial, so
+// initial gets nil edges to everything reachable that way, and a $ anchor can
+// only be followed at the end, so its source is accepting if an accepting
+// state is reachable through it without consuming anything.
+func (b *regexpBuilder) resolveAnchors(initial *state) {
+	closure := func(s *state, anchors ...map[*state][]*state) stateSet {
+		set := singleton(s)
+		q := []*state{s}
+		add := func(t *state) {
+			if _, seen := set[t]; !seen {
+				set[t] = struct{}{}
+				q = append(q, t)
+			}
+		}
+		for len(q) > 0 {
+			n := q[0]
+			q = q[1:]
+			for _, e := range n.Out {
+				if e.Expr == nil {
+					add(e.State)
+				}
+			}
+			for _, a := range anchors {
+				for _, t := range a[n] {
+					add(t)
+				}
+			}
+		}
+		return set
+	}
+	accepts := func(set stateSet) bool {
+		for s := range set {
+			if s.Accept {
+				return true
+			}
+		}
+		return false
+	}
+
+	// Anchors in any order can be followed when the path is empty.
+	emptyOK := accepts(closure(initial, b.begin, b.end))
+
+	for s := range closure(initial, b.begin) {
+		if s != initial {
+			initial.Out = append(initial.Out, edge{State: s})
+		}
+	}
+	for s, ts := range b.end {
+		for _, t := range ts {
+			if accepts(closure(t, b.end)) {
+				s.Accept = true
+			}
+		}
+	}
+	if emptyOK {
+		initial.Accept = true
+	}
+	clear(b.begin)
+	clear(b.end)
+}
+
+// regexpRoot returns the longest literal directory (empty, or ending in /)
+// that every path matched from initial must start with.
+func regexpRoot(initial *state) string {
+	var root strings.Builder
+	dir := 0
+	states := matchSegment(singleton(initial), "")
+	for len(states) > 0 {
+		var lit rune = -1
+		for s := range states {
+			if s.Accept {
+				return root.String()[:dir]
+			}
+			for _, e := range s.Out {
+				if e.Expr == nil {
+					continue
+				}
+				l, ok := e.Expr.(literalExp)
+				if !ok || (lit >= 0 && rune(l) != lit) {
+					return root.String()[:dir]
+				}
+				lit = rune(l)
+			}
+		}
+		if lit < 0 {
+			break
+		}
+		root.WriteRune(lit)
+		if lit == '/' {
+			dir = root.Len()
+		}
+		states = matchSegment(states, string(lit))
+	}
+	return root.String()[:dir]
+}
@@ -0,0 +1,194 @@
+package zzglob
+
+import (
+	"context"
+	"regexp"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"unicode/utf8"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+var parseRegexpTests = []struct {
+	expr  string
+	paths []string
+}{
+	{`^src/.*\.go$`, []string{"src/a.go", "src/x/y.go", "src/a.gox", "xsrc/a.go", "src/", "src/.go"}},
+	{`\.go$`, []string{"a.go", "x/y.go", "a.go/b", ".go", "a.gox"}},
+	{`^src/`, []string{"src/", "src/a", "src", "x/src/a"}},
+	{`test`, []string{"test", "a/test/b", "tes", "TEST"}},
+	{`(?i)^readme\.md$`, []string{"README.md", "readme.MD", "readme.mdx", "docs/README.md"}},
+	{`^(src|lib)/[a-z]+_test\.go$`, []string{"src/foo_test.go", "lib/x_test.go", "src/Foo_test.go", "src/a/b_test.go", "doc/a_test.go"}},
+	{`^a/(?:b/)*c$`, []string{"a/c", "a/b/c", "a/b/b/c", "a/bc", "a/b/"}},
+	{`^a/b{2,3}/c$`, []string{"a/b/c", "a/bb/c", "a/bbb/c", "a/bbbb/c"}},
+	{`^[^/]+$`, []string{"a", "a/b", "", "/"}},
+	{`^.$`, []string{"a", "\n", "/", "ab", "中"}},
+	{`(?s)^.$`, []string{"a", "\n", "/"}},
+	{`^$`, []string{"", "a"}},
+	{`^`, []string{"", "a", "a/b"}},
+	{`x^`, []string{"", "x", "ax"}},
+	{`$^`, []string{"", "a"}},
+	{`^a|b$`, []string{"a", "ab", "ba", "xb", "xa", "b"}},
+	{`^(?:a$|b)c?$`, []string{"a", "ac", "b", "bc", "c"}},
+	{`[[:digit:]]{3}`, []string{"123", "a/456/b", "12", "1/23"}},
+	{`\p{Greek}+\.txt$`, []string{"αβγ.txt", "abc.txt", "x/Ω.txt"}},
+	{`[^a]`, []string{"a", "b", "aa", "/", ""}},
+}
+
+func TestParseRegexp(t *testing.T) {
+	for _, test := range parseRegexpTests {
+		p, err := ParseRegexp(test.expr)
+		if err != nil {
+			t.Fatalf("ParseRegexp(%q) = %v", test.expr, err)
+		}
+		re := regexp.MustCompile(test.expr)
+		for _, path := range test.paths {
+			if got, want := p.Match(path), re.MatchString(path); got != want {
+				t.Errorf("ParseRegexp(%q).Match(%q) = %t, want %t", test.expr, path, got, want)
+			}
+		}
+	}
+}
+
+func TestParseRegexp_Root(t *testing.T) {
+	tests := []struct {
+		expr, want string
+	}{
+		{`^src/.*\.go$`, "src/"},
+		{`^src/lib/[a-z]+/x$`, "src/lib/"},
+		{`^src/lib$`, "src/"},
+		{`^/etc/.*\.conf$`, "/etc/"},
+		{`^(?:src/a|src/b)/x$`, "src/"},
+		{`^src/a|^src/b`, "src/"},
+		{`^(?i)src/x$`, ""},
+		{`src/x$`, ""},
+		{`^s+/x`, ""},
+		{`^src/?x`, ""},
+		{`^src/$`, "src/"},
+	}
+
+	for _, test := range tests {
+		p, err := ParseRegexp(test.expr)
+		if err != nil {
+			t.Fatalf("ParseRegexp(%q) = %v", test.expr, err)
+		}
+		if p.root != test.want {
+			t.Errorf("ParseRegexp(%q).root = %q, want %q", test.expr, p.root, test.want)
+		}
+	}
+}
+
+func TestParseRegexp_Errors(t *testing.T) {
+	tests := []struct {
+		expr, want string
+	}{
+		{`(a)\1`, "backreferences are not supported"},
+		{`\bfoo`, "word boundary"},
+		{`foo\B`, "word boundary"},
+		{`(?m)^foo$`, "multi-line anchor"},
+		{`(?=foo)`, "invalid or unsupported Perl syntax"},
+		{`[a-`, "missing closing ]"},
+	}
+
+	for _, test := range tests {
+		_, err := ParseRegexp(test.expr)
+		if err == nil || !strings.Contains(err.Error(), test.want) {
+			t.Errorf("ParseRegexp(%q) = %v, want error containing %q", test.expr, err, test.want)
+		}
+	}
+}
+
+func TestParseRegexp_Glob(t *testing.T) {
+	fsys := &readDirRecorder{
+		FS: fstest.MapFS{
+			"src/a.go":            {},
+			"src/a_test.go":       {},
+			"src/lib/b.go":        {},
+			"src/lib/b_test.go":   {},
+			"src/gen/c.go":        {},
+			"docs/index.md":       {},
+			"node_modules/x/y.js": {},
+		},
+	}
+	p, err := ParseRegexp(`^src/(?:lib/)?[a-z]+_test\.go$`)
+	if err != nil {
+		t.Fatalf("ParseRegexp(...) = %v", err)
+	}
+
+	var got walkFuncCalls
+	if err := p.Glob(got.walkFunc, traceLogOpt, WithFilesystem(fsys)); err != nil {
+		t.Fatalf("Glob(...) = %v", err)
+	}
+	got.sortCalls()
+
+	want := []walkFuncArgs{
+		{Path: "src/a_test.go"},
+		{Path: "src/lib/b_test.go"},
+	}
+	if diff := cmp.Diff(got.calls, want); diff != "" {
+		t.Errorf("walked paths diff (-got +want):\n%s", diff)
+	}
+
+	// The walk starts at src, and src/gen is pruned.
+	wantReads := []string{"src", "src/lib"}
+	if diff := cmp.Diff(fsys.reads, wantReads); diff != "" {
+		t.Errorf("read directories diff (-got +want):\n%s", diff)
+	}
+}
+
+func TestParseRegexp_MultiGlob(t *testing.T) {
+	patterns := []*Pattern{
+		MustParse("fixtures/a/b/cid/**/m"),
+	}
+	p, err := ParseRegexp(`^fixtures/a/b/c[o]d/.*/m$`)
+	if err != nil {
+		t.Fatalf("ParseRegexp(...) = %v", err)
+	}
+	patterns = append(patterns, p)
+
+	var got walkFuncCalls
+	if err := MultiGlob(context.Background(), patterns, got.walkFunc, traceLogOpt); err != nil {
+		t.Fatalf("MultiGlob(...) = %v", err)
+	}
+	got.sortCalls()
+
+	want := []walkFuncArgs{
+		{Path: "fixtures/a/b/cid/erf/h/k/m"},
+		{Path: "fixtures/a/b/cid/erf/h/k/n/m"},
+		{Path: "fixtures/a/b/cid/erf/i/m"},
+		{Path: "fixtures/a/b/cid/erf/i/n/m"},
+		{Path: "fixtures/a/b/cod/erf/h/k/m"},
+		{Path: "fixtures/a/b/cod/erf/h/k/n/m"},
+		{Path: "fixtures/a/b/cod/erf/i/m"},
+		{Path: "fixtures/a/b/cod/erf/i/n/m"},
+	}
+	if diff := cmp.Diff(got.calls, want); diff != "" {
+		t.Errorf("walked paths diff (-got +want):\n%s", diff)
+	}
+}
+
+func FuzzParseRegexp(f *testing.F) {
+	for _, test := range parseRegexpTests {
+		for _, path := range test.paths {
+			f.Add(test.expr, path)
+		}
+	}
+	f.Fuzz(func(t *testing.T, expr, path string) {
+		if !utf8.ValidString(expr) || !utf8.ValidString(path) {
+			return
+		}
+		re, err := regexp.Compile(expr)
+		if err != nil {
+			return
+		}
+		p, err := ParseRegexp(expr)
+		if err != nil {
+			return
+		}
+		if got, want := p.Match(path), re.MatchString(path); got != want {
+			t.Errorf("ParseRegexp(%q).Match(%q) = %t, but regexp.MatchString = %t", expr, path, got, want)
+		}
+	})
+}
@@ -3,7 +3,7 @@ package zzglob
 import (
 	"errors"
 	"fmt"
-	"slices"
+	"strconv"
 )
 
 type parserContext int
@@ -11,12 +11,16 @@ type parserContext int
 const (
 	parserInsideNothing parserContext = iota
 	parserInsideAlternation
+	parserInsideExtGlob
 )
 
 // parseSequence parses a sequence.
-func parseSequence(tkns *tokens, pctx parserContext) (start, end *state, endedWith token, err error) {
+func parseSequence(tkns *tokens, pctx parserContext, cfg *parseConfig) (start, end *state, endedWith token, err error) {
 	start = &state{}
 	end = start
+	// The state where the most recently completed segment (ending in /)
+	// started, and where the current segment started.
+	prevSeg, seg := start, start
 	appendExp := func(e expression) {
 		next := &state{}
 		end.Out = append(end.Out, edge{
@@ -34,9 +38,20 @@ func parseSequence(tkns *tokens, pctx parserContext) (start, end *state, endedWi
 
 		if t >= 0 {
 			appendExp(literalExp(t))
+			if t == '/' {
+				prevSeg, seg = seg, end
+			}
 			continue
 		}
 
+		// Record what wildcards and alternations match?
+		group := -1
+		if cfg.groups != nil && isCaptureToken(t) {
+			group = *cfg.groups
+			*cfg.groups++
+			end = appendTag(end, 2*group+1)
+		}
+
 		switch t {
 		case tokenStar:
 			end.Out = append(end.Out, edge{
@@ -44,7 +59,17 @@ func parseSequence(tkns *tokens, pctx parserContext) (start, end *state, endedWi
 				State: end,
 			})
 
-		case tokenDoubleStar:
+		case tokenDoubleStar, tokenImplicitDoubleStar:
+			if len(*tkns) > 0 && (*tkns)[0] == tokenOpenRepeat {
+				// Bounded number of segments, e.g. **{1,3}
+				tkns.next()
+				min, max, err := parseRepeatBounds(tkns)
+				if err != nil {
+					return nil, nil, 0, err
+				}
+				end = appendSegments(end, min, max)
+				break
+			}
 			end.Out = append(end.Out, edge{
 				Expr:  doubleStarExp{},
 				State: end,
@@ -53,8 +78,21 @@ func parseSequence(tkns *tokens, pctx parserContext) (start, end *state, endedWi
 		case tokenQuestion:
 			appendExp(questionExp{})
 
-		case tokenOpenBrace:
-			ed, err := parseAlternation(tkns, end)
+		case tokenOpenRepeat:
+			// The tokeniser only produces this after /, so repeat the segment
+			// that just ended.
+			min, max, err := parseRepeatBounds(tkns)
+			if err != nil {
+				return nil, nil, 0, err
+			}
+			end, err = repeatSegment(prevSeg, end, min, max)
+			if err != nil {
+				return nil, nil, 0, err
+			}
+			prevSeg, seg = end, end
+
+		case tokenOpenBrace, tokenOpenImplicitBrace:
+			ed, err := parseAlternation(tkns, end, cfg)
 			if err != nil {
 				return nil, nil, 0, err
 			}
@@ -82,6 +120,26 @@ func parseSequence(tkns *tokens, pctx parserContext) (start, end *state, endedWi
 		case tokenCloseBracket:
 			appendExp(literalExp(']'))
 
+		case tokenExtQuestion, tokenExtStar, tokenExtPlus, tokenExtAt, tokenExtBang:
+			ed, err := parseExtGlob(tkns, end, t, cfg)
+			if err != nil {
+				return nil, nil, 0, err
+			}
+			end = ed
+
+		case tokenOpenNumericRange:
+			ed, err := parseNumericRange(tkns, end)
+			if err != nil {
+				return nil, nil, 0, err
+			}
+			end = ed
+
+		case tokenPipe, tokenCloseParen:
+			if pctx == parserInsideExtGlob {
+				return start, end, t, nil
+			}
+			appendExp(literalExp(-t))
+
 		case tokenBracketCaret:
 			ed, err := parseNegatedCharClass(tkns, end)
 			if err != nil {
@@ -92,15 +150,43 @@ func parseSequence(tkns *tokens, pctx parserContext) (start, end *state, endedWi
 		default:
 			return nil, nil, 0, fmt.Errorf("invalid punctuation %c", t)
 		}
+
+		if group >= 0 {
+			end = appendTag(end, 2*group+2)
+		}
 	}
 }
 
+// isCaptureToken reports whether the token starts something that is a
+// capture group when capturing: wildcards, char classes, alternations, and
+// so on.
+func isCaptureToken(t token) bool {
+	switch t {
+	case tokenStar, tokenDoubleStar, tokenQuestion, tokenOpenBrace,
+		tokenOpenBracket, tokenBracketCaret, tokenOpenNumericRange,
+		tokenExtQuestion, tokenExtStar, tokenExtPlus, tokenExtAt, tokenExtBang:
+		return true
+	}
+	return false
+}
+
+// appendTag appends a nil edge with a tag to a new state.
+func appendTag(from *state, tag int) *state {
+	next := &state{}
+	from.Out = append(from.Out, edge{Expr: nil, State: next, Tag: tag})
+	return next
+}
+
 // parseAlternation appends a branch to the automaton, a sequence in each
 // branch, then a merge.
-func parseAlternation(tks *tokens, from *state) (end *state, err error) {
+func parseAlternation(tks *tokens, from *state, cfg *parseConfig) (end *state, err error) {
+	if isBraceSequence(*tks) {
+		return parseBraceSequence(tks, from)
+	}
+
 	end = &state{}
 	for {
-		st, ed, done, err := parseSequence(tks, parserInsideAlternation)
+		st, ed, done, err := parseSequence(tks, parserInsideAlternation, cfg)
 		if err != nil {
 			return nil, err
 		}
@@ -126,69 +212,387 @@ func parseAlternation(tks *tokens, from *state) (end *state, err error) {
 	}
 }
 
+// isBraceSequence reports whether tks (following an opening brace) is a brace
+// sequence, i.e. consists of literals and at least one tokenDotDot, up to the
+// closing brace.
+func isBraceSequence(tks tokens) bool {
+	dotdot := false
+	for _, t := range tks {
+		switch {
+		case t >= 0:
+			continue
+		case t == tokenDotDot:
+			dotdot = true
+		case t == tokenCloseBrace:
+			return dotdot
+		default:
+			return false
+		}
+	}
+	return false
+}
+
+// parseExtGlob parses an extended glob operator. op is the token for the
+// operator, and tks should start with the first token following it.
+func parseExtGlob(tks *tokens, from *state, op token, cfg *parseConfig) (end *state, err error) {
+	// Parse the alternatives into a sub-automaton from subStart to subEnd,
+	// like parseAlternation.
+	subStart, subEnd := &state{}, &state{}
+	for done := token(0); done != tokenCloseParen; {
+		st, ed, dn, err := parseSequence(tks, parserInsideExtGlob, cfg)
+		if err != nil {
+			return nil, err
+		}
+		if dn != tokenPipe && dn != tokenCloseParen {
+			return nil, fmt.Errorf("unterminated %s - missing closing parenthesis", op)
+		}
+		subStart.Out = append(subStart.Out, edge{
+			Expr:  nil,
+			State: st,
+		})
+		ed.Out = append(ed.Out, edge{
+			Expr:  nil,
+			State: subEnd,
+		})
+		done = dn
+	}
+
+	end = &state{}
+	switch op {
+	case tokenExtAt:
+		// from -> sub -> end
+		from.Out = append(from.Out, edge{Expr: nil, State: subStart})
+		subEnd.Out = append(subEnd.Out, edge{Expr: nil, State: end})
+
+	case tokenExtQuestion:
+		// from -> sub -> end, or from -> end
+		from.Out = append(from.Out,
+			edge{Expr: nil, State: subStart},
+			edge{Expr: nil, State: end},
+		)
+		subEnd.Out = append(subEnd.Out, edge{Expr: nil, State: end})
+
+	case tokenExtStar:
+		// from -> loop, loop -> sub -> loop, loop -> end.
+		// loop has two out-edges, so reduce won't go around in circles.
+		loop := &state{}
+		from.Out = append(from.Out, edge{Expr: nil, State: loop})
+		loop.Out = append(loop.Out,
+			edge{Expr: nil, State: subStart},
+			edge{Expr: nil, State: end},
+		)
+		subEnd.Out = append(subEnd.Out, edge{Expr: nil, State: loop})
+
+	case tokenExtPlus:
+		// from -> sub -> loop, loop -> sub, loop -> end
+		loop := &state{}
+		from.Out = append(from.Out, edge{Expr: nil, State: subStart})
+		subEnd.Out = append(subEnd.Out, edge{Expr: nil, State: loop})
+		loop.Out = append(loop.Out,
+			edge{Expr: nil, State: subStart},
+			edge{Expr: nil, State: end},
+		)
+
+	case tokenExtBang:
+		// Match any sequence of non-/ runes not accepted by the
+		// sub-automaton. The complement of an NFA is made by determinising
+		// it (totally), then flipping which states accept.
+		// Case folding has to happen before complementing, since the
+		// complement of the folded automaton is not the fold of the
+		// complement.
+		subEnd.Accept = true
+		if cfg.caseInsensitive {
+			foldCase(subStart)
+		}
+		comp := determinise(subStart, notSlashRanges, true)
+		from.Out = append(from.Out, edge{Expr: nil, State: comp})
+		visit(comp, func(s *state) {
+			if !s.Accept {
+				s.Out = append(s.Out, edge{Expr: nil, State: end})
+			}
+			s.Accept = false
+		})
+
+	default:
+		return nil, fmt.Errorf("invalid extended glob operator %s (%d)", op, op)
+	}
+	return end, nil
+}
+
 // parseCharClass is like parseAlternation, except each branch only matches
 // exactly one character.
 func parseCharClass(tks *tokens, from *state) (end *state, err error) {
+	items, classes, err := parseCharClassItems(tks, "char class")
+	if err != nil {
+		return nil, err
+	}
 	end = &state{}
+	for _, r := range items {
+		from.Out = append(from.Out, edge{
+			Expr:  r.exp(),
+			State: end,
+		})
+	}
+	for _, c := range classes {
+		from.Out = append(from.Out, edge{
+			Expr:  c,
+			State: end,
+		})
+	}
+	return end, nil
+}
+
+// parseNegatedCharClass parses a negated char class. tks should start with the
+// the first token following `[^`.
+func parseNegatedCharClass(tks *tokens, from *state) (*state, error) {
+	items, classes, err := parseCharClassItems(tks, "negated char class")
+	if err != nil {
+		return nil, err
+	}
+
+	end := &state{}
+
+	expr := negatedCCExp{
+		ranges:  mergeRanges(items),
+		classes: classes,
+	}
+	if len(expr.ranges) == 1 && expr.ranges[0].lo == expr.ranges[0].hi && len(classes) == 0 {
+		from.Out = append(from.Out, edge{
+			Expr:  negatedLiteralExp(expr.ranges[0].lo),
+			State: end,
+		})
+		return end, nil
+	}
+
+	from.Out = append(from.Out, edge{
+		Expr:  expr,
+		State: end,
+	})
+	return end, nil
+}
+
+// parseCharClassItems parses the contents of a char class (up to and
+// including the closing square bracket) into a list of ranges and a list of
+// named classes. Single characters are returned as ranges with lo == hi.
+// kind is used for error messages.
+func parseCharClassItems(tks *tokens, kind string) ([]rangeExp, []namedClassExp, error) {
+	var items []rangeExp
+	var classes []namedClassExp
 	for {
 		t, ok := tks.next()
 		if !ok {
-			return nil, errors.New("unterminated char class - missing closing square bracket")
+			return nil, nil, fmt.Errorf("unterminated %s - missing closing square bracket", kind)
 		}
-		if t >= 0 {
-			from.Out = append(from.Out, edge{
-				Expr:  literalExp(t),
-				State: end,
-			})
+		switch {
+		case t == tokenCloseBracket:
+			return items, classes, nil
+
+		case t == tokenOpenPOSIXClass, t == tokenOpenUnicodeClass, t == tokenOpenNegUnicodeClass:
+			c, err := parseNamedClass(tks, t)
+			if err != nil {
+				return nil, nil, err
+			}
+			classes = append(classes, c)
 			continue
+
+		case t == tokenDash:
+			// A - that doesn't follow a character (e.g. at the start) is
+			// a literal.
+			t = '-'
+
+		case t < 0:
+			return nil, nil, fmt.Errorf("invalid %s (%d) within %s", t, t, kind)
 		}
 
-		if t != tokenCloseBracket {
-			return nil, fmt.Errorf("invalid %s (%d) within char class", t, t)
+		// Is this the start of a range? A - right before the closing
+		// bracket is a literal.
+		rest := *tks
+		if len(rest) < 2 || rest[0] != tokenDash || rest[1] == tokenCloseBracket {
+			items = append(items, rangeExp{rune(t), rune(t)})
+			continue
 		}
-		return end, nil
+		tks.next() // the -
+		hi, _ := tks.next()
+		if hi == tokenDash {
+			hi = '-'
+		}
+		if hi < 0 {
+			return nil, nil, fmt.Errorf("invalid %s (%d) at end of range within %s", hi, hi, kind)
+		}
+		if hi < t {
+			return nil, nil, fmt.Errorf("invalid range %c-%c within %s - start is after end", t, hi, kind)
+		}
+		items = append(items, rangeExp{rune(t), rune(hi)})
 	}
 }
 
-// parseNegatedCharClass parses a negated char class. tks should start with the
-// the first token following `[^`.
-func parseNegatedCharClass(tks *tokens, from *state) (*state, error) {
-	runes := make(map[rune]struct{})
+// parseNamedClass parses a named class. open is the token that opened the
+// named class (which determines which kind of class it is), and tks should
+// start with the first token following it.
+func parseNamedClass(tks *tokens, open token) (namedClassExp, error) {
+	var name []rune
 	for {
 		t, ok := tks.next()
 		if !ok {
-			return nil, errors.New("unterminated negated char class - missing closing square bracket")
+			return namedClassExp{}, fmt.Errorf("unterminated named class %s", open)
 		}
 		if t >= 0 {
-			runes[rune(t)] = struct{}{}
+			name = append(name, rune(t))
 			continue
 		}
+		switch {
+		case open == tokenOpenPOSIXClass && t == tokenClosePOSIXClass:
+			return posixClass(string(name))
+		case open != tokenOpenPOSIXClass && t == tokenCloseUnicodeClass:
+			return unicodeClass(string(name), open == tokenOpenNegUnicodeClass)
+		}
+		return namedClassExp{}, fmt.Errorf("invalid %s (%d) within named class", t, t)
+	}
+}
 
-		if t != tokenCloseBracket {
-			return nil, fmt.Errorf("invalid %s (%d) within negated char class", t, t)
+// maxSegmentRepetition limits the size of the automaton produced by segment
+// repetitions.
+const maxSegmentRepetition = 256
+
+// parseRepeatBounds parses the bounds of a segment repetition (following
+// tokenOpenRepeat). If there is no upper bound, max is -1.
+func parseRepeatBounds(tks *tokens) (min, max int, err error) {
+	var bounds [2]string
+	n := 1
+	for {
+		t, ok := tks.next()
+		if !ok {
+			return 0, 0, errors.New("unterminated repetition - missing }")
+		}
+		switch {
+		case t >= 0:
+			bounds[n-1] += string(rune(t))
+			continue
+		case t == tokenComma && n == 1:
+			n++
+			continue
+		case t == tokenCloseRepeat:
+		default:
+			return 0, 0, fmt.Errorf("invalid %s (%d) within repetition", t, t)
 		}
 		break
 	}
 
-	end := &state{}
+	if bounds[0] != "" {
+		if min, err = strconv.Atoi(bounds[0]); err != nil {
+			return 0, 0, fmt.Errorf("invalid repetition minimum %q: %w", bounds[0], err)
+		}
+	}
+	switch {
+	case n == 1:
+		// {n} means exactly n
+		max = min
+	case bounds[1] == "":
+		max = -1
+	default:
+		if max, err = strconv.Atoi(bounds[1]); err != nil {
+			return 0, 0, fmt.Errorf("invalid repetition maximum %q: %w", bounds[1], err)
+		}
+		if max < min {
+			return 0, 0, fmt.Errorf("invalid repetition {%s,%s} - minimum is greater than maximum", bounds[0], bounds[1])
+		}
+	}
+	if min > maxSegmentRepetition || max > maxSegmentRepetition {
+		return 0, 0, fmt.Errorf("repetition too large (limit %d)", maxSegmentRepetition)
+	}
+	return min, max, nil
+}
 
-	expr := make(negatedCCExp, 0, len(runes))
-	for r := range runes {
-		expr = append(expr, r)
+// appendSegments appends a sequence of min to max path segments (each
+// matching any characters except /), separated by /. If max is -1, there is
+// no upper limit.
+func appendSegments(from *state, min, max int) (end *state) {
+	end = &state{}
+	if min == 0 {
+		from.Out = append(from.Out, edge{Expr: nil, State: end})
 	}
-	if len(expr) == 1 {
-		from.Out = append(from.Out, edge{
-			Expr:  negatedLiteralExp(expr[0]),
-			State: end,
-		})
-		return end, nil
+	if max == 0 {
+		return end
+	}
+
+	// seg is the state within the i-th segment.
+	seg := &state{}
+	seg.Out = append(seg.Out, edge{Expr: starExp{}, State: seg})
+	from.Out = append(from.Out, edge{Expr: nil, State: seg})
+	for i := 1; ; i++ {
+		if i >= min {
+			seg.Out = append(seg.Out, edge{Expr: nil, State: end})
+		}
+		if i == max {
+			return end
+		}
+		next := &state{}
+		next.Out = append(next.Out, edge{Expr: starExp{}, State: next})
+		seg.Out = append(seg.Out, edge{Expr: literalExp('/'), State: next})
+		if max < 0 && i >= min {
+			// Unbounded: loop back for any further segments.
+			next.Out = append(next.Out, edge{Expr: nil, State: seg})
+			return end
+		}
+		seg = next
 	}
+}
 
-	slices.Sort(expr)
+// repeatSegment replaces the segment (the automaton fragment from entry to
+// exit) with min to max repetitions of it. If max is -1, there is no upper
+// limit.
+func repeatSegment(entry, exit *state, min, max int) (end *state, err error) {
+	if entry == exit {
+		return nil, errors.New("repetition of an empty segment")
+	}
 
-	from.Out = append(from.Out, edge{
-		Expr:  expr,
-		State: end,
-	})
+	// Each repetition is a copy of the segment (so that loops within each
+	// copy stay within that copy).
+	tmplEntry, tmplExit := cloneFragment(entry, exit)
+	entry.Out = nil
+
+	copies := max
+	if max < 0 {
+		// The final copy loops.
+		copies = min + 1
+	}
+	end = &state{}
+	cur := entry
+	for i := 0; i < copies; i++ {
+		if i >= min {
+			cur.Out = append(cur.Out, edge{Expr: nil, State: end})
+		}
+		ce, cx := cloneFragment(tmplEntry, tmplExit)
+		cur.Out = append(cur.Out, edge{Expr: nil, State: ce})
+		if max < 0 && i == copies-1 {
+			cx.Out = append(cx.Out, edge{Expr: nil, State: ce})
+		}
+		cur = cx
+	}
+	cur.Out = append(cur.Out, edge{Expr: nil, State: end})
 	return end, nil
 }
+
+// cloneFragment copies every state reachable from entry (which should not
+// include anything beyond exit), returning the copies of entry and exit.
+func cloneFragment(entry, exit *state) (*state, *state) {
+	copies := map[*state]*state{
+		entry: {Accept: entry.Accept},
+	}
+	q := []*state{entry}
+	for len(q) > 0 {
+		s := q[0]
+		q = q[1:]
+		c := copies[s]
+		for _, e := range s.Out {
+			t := copies[e.State]
+			if t == nil {
+				t = &state{Accept: e.State.Accept}
+				copies[e.State] = t
+				q = append(q, e.State)
+			}
+			c.Out = append(c.Out, edge{Expr: e.Expr, State: t, Tag: e.Tag})
+		}
+	}
+	return copies[entry], copies[exit]
+}
@@ -0,0 +1,139 @@
+package zzglob
+
+import (
+	"slices"
+	"strings"
+)
+
+// maxPathsRange is the largest character range (e.g. [a-z], or the digits of
+// a brace sequence) that Paths expands.
+const maxPathsRange = 256
+
+// maxPaths is the most paths that Paths returns. Small classes multiply
+// quickly (e.g. [a-z][a-z][a-z][a-z] matches 456976 paths).
+const maxPaths = 1 << 16
+
+// Paths returns, in sorted order, every path that the pattern matches, and
+// true, if the pattern consists only of literals, alternations, brace
+// sequences, and small character classes (like Bash brace expansion, so
+// cmd/{api,worker}/main.go gives cmd/api/main.go and cmd/worker/main.go).
+// Otherwise, including when the pattern has wildcards, negated classes,
+// unbounded repetition, or is case-insensitive, it returns nil, false. It
+// also returns nil, false if there would be more than 65536 paths. The
+// filesystem isn't used.
+func (p *Pattern) Paths() ([]string, bool) {
+	return p.paths(maxPaths)
+}
+
+// paths is Paths, but gives up (returning nil, false) once there are more
+// than limit paths, if limit is not negative.
+func (p *Pattern) paths(limit int) ([]string, bool) {
+	if p.inputConfig.caseInsensitive {
+		return nil, false
+	}
+	if p.initial == nil {
+		return []string{p.root}, true
+	}
+	prog := compile(p.initial)
+	for _, ps := range prog.states {
+		for _, e := range ps.edges {
+			switch x := e.expr.(type) {
+			case literalExp:
+			case rangeExp:
+				if x.hi-x.lo >= maxPathsRange {
+					return nil, false
+				}
+			default:
+				return nil, false
+			}
+		}
+	}
+
+	// Depth-first search over sets of states. Reaching a set that is
+	// already on the stack means there is a loop (consuming at least one
+	// rune), so there are infinitely many paths.
+	var paths []string
+	onStack := make(map[string]bool)
+	seen := make([]bool, len(prog.states))
+	path := []rune(p.root)
+	var search func(set []int32) bool
+	search = func(set []int32) bool {
+		key := setKey(set)
+		if onStack[key] {
+			return false
+		}
+		onStack[key] = true
+		defer delete(onStack, key)
+
+		var next []rune
+		for _, id := range set {
+			ps := &prog.states[id]
+			if ps.accept && (len(paths) == 0 || paths[len(paths)-1] != string(path)) {
+				paths = append(paths, string(path))
+				if limit >= 0 && len(paths) > limit {
+					return false
+				}
+			}
+			for _, e := range ps.edges {
+				for _, r := range e.expr.runeRanges() {
+					for x := r.lo; x <= r.hi; x++ {
+						next = append(next, x)
+					}
+				}
+			}
+		}
+		slices.Sort(next)
+		for _, r := range slices.Compact(next) {
+			path = append(path, r)
+			ok := search(prog.step(set, r, seen))
+			path = path[:len(path)-1]
+			if !ok {
+				return false
+			}
+		}
+		return true
+	}
+	if !search(prog.start) {
+		return nil, false
+	}
+	return paths, true
+}
+
+// compareWalkOrder compares paths in the order that fs.WalkDir would walk
+// them: one segment at a time, so that a directory, and everything within it,
+// comes before its later siblings (e.g. a/x before a-b, even though - sorts
+// before /). Trailing slashes are ignored, except to break ties.
+func compareWalkOrder(a, b string) int {
+	x, y := strings.TrimSuffix(a, "/"), strings.TrimSuffix(b, "/")
+	for {
+		xs, xrest, xok := strings.Cut(x, "/")
+		ys, yrest, yok := strings.Cut(y, "/")
+		if c := strings.Compare(xs, ys); c != 0 {
+			return c
+		}
+		switch {
+		case !xok && !yok:
+			return strings.Compare(a, b)
+		case !xok:
+			// x is a directory containing y.
+			return -1
+		case !yok:
+			return 1
+		}
+		x, y = xrest, yrest
+	}
+}
+
+// isWalkable reports whether the relative path could be produced by walking
+// (i.e. it is clean, not empty, and doesn't leave the root).
+func isWalkable(rel string) bool {
+	if rel == "" || rel == "." || strings.HasPrefix(rel, "/") {
+		return false
+	}
+	for _, seg := range strings.Split(rel, "/") {
+		if seg == "" || seg == "." || seg == ".." {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,210 @@
+package zzglob
+
+import (
+	"context"
+	"io/fs"
+	"testing"
+	"testing/fstest"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestPattern_Paths(t *testing.T) {
+	tests := []struct {
+		pattern string
+		opts    []ParseOption
+		want    []string
+		wantOK  bool
+	}{
+		{"cmd/{api,worker}/{main,config}.go", nil, []string{"cmd/api/config.go", "cmd/api/main.go", "cmd/worker/config.go", "cmd/worker/main.go"}, true},
+		{"a/b", nil, []string{"a/b"}, true},
+		{"a/{b,b,c}", nil, []string{"a/b", "a/c"}, true},
+		{"{a,}b", nil, []string{"ab", "b"}, true},
+		{"{x,x/y}/", nil, []string{"x/", "x/y/"}, true},
+		{"a[b]c", nil, []string{"abc"}, true},
+		{"v{1..3}", []ParseOption{AllowBraceSequence(true)}, []string{"v1", "v2", "v3"}, true},
+		{"a/*.go", nil, nil, false},
+		{"a/?", nil, nil, false},
+		{"a/[bc]", nil, []string{"a/b", "a/c"}, true},
+		{"a/[b-d]", nil, []string{"a/b", "a/c", "a/d"}, true},
+		{"a/[^b]", nil, nil, false},
+		{"a/[[:alpha:]]", []ParseOption{AllowNamedCharClass(true)}, nil, false},
+		{"a/**", nil, nil, false},
+		{"a/{b,c*}", nil, nil, false},
+		{"a/b", []ParseOption{CaseInsensitive(true)}, nil, false},
+		{"a/{b,c}", []ParseOption{CaseInsensitive(true)}, nil, false},
+		{"x/{a/,}{b,c}", nil, []string{"x/a/b", "x/a/c", "x/b", "x/c"}, true},
+		{"[a-z][a-z][a-z][a-z][a-z]", nil, nil, false}, // too many
+	}
+
+	for _, test := range tests {
+		p, err := Parse(test.pattern, test.opts...)
+		if err != nil {
+			t.Fatalf("Parse(%q) = %v", test.pattern, err)
+		}
+		got, ok := p.Paths()
+		if ok != test.wantOK {
+			t.Errorf("Parse(%q).Paths() ok = %t, want %t", test.pattern, ok, test.wantOK)
+		}
+		if diff := cmp.Diff(got, test.want); diff != "" {
+			t.Errorf("Parse(%q).Paths() diff (-got +want):\n%s", test.pattern, diff)
+		}
+		for _, path := range got {
+			if !p.Match(path) {
+				t.Errorf("Parse(%q).Paths() contains %q, but Match(%q) = false", test.pattern, path, path)
+			}
+		}
+	}
+}
+
+func TestPattern_Paths_Limit(t *testing.T) {
+	got, ok := MustParse("[a-p][a-p][a-p][a-p]").Paths()
+	if !ok || len(got) != maxPaths {
+		t.Errorf("Paths() = %d paths, %t, want %d paths, true", len(got), ok, maxPaths)
+	}
+	if got, ok := MustParse("[a-p][a-p][a-p][a-q]").Paths(); ok {
+		t.Errorf("Paths() = %d paths, true, want nil, false", len(got))
+	}
+}
+
+func TestPattern_Paths_Repetition(t *testing.T) {
+	p, err := Parse("a/{b,c}/{1,2}x", AllowSegmentRepetition(true))
+	if err != nil {
+		t.Fatalf("Parse(...) = %v", err)
+	}
+	got, ok := p.Paths()
+	if !ok {
+		t.Fatalf("Paths() = %v, false, want true", got)
+	}
+	want := []string{"a/b/x", "a/b/b/x", "a/b/c/x", "a/c/x", "a/c/b/x", "a/c/c/x"}
+	for _, w := range want {
+		if !p.Match(w) {
+			t.Errorf("Match(%q) = false, want true", w)
+		}
+	}
+	if len(got) != len(want) {
+		t.Errorf("Paths() = %q, want %d paths", got, len(want))
+	}
+
+	p, err = Parse("a/{b,c}/{1,}x", AllowSegmentRepetition(true))
+	if err != nil {
+		t.Fatalf("Parse(...) = %v", err)
+	}
+	if got, ok := p.Paths(); ok {
+		t.Errorf("Paths() = %q, true, want nil, false", got)
+	}
+}
+
+func TestGlob_FinitePaths(t *testing.T) {
+	fsys := &readDirRecorder{
+		FS: fstest.MapFS{
+			"cmd/api/main.go":      {},
+			"cmd/api/config.go":    {},
+			"cmd/worker/main.go":   {},
+			"cmd/worker/other.go":  {},
+			"cmd/config.go/x":      {},
+			"cmd/tool/main.go/foo": {},
+		},
+	}
+	p := MustParse("cmd/{api,worker,tool}/{main,config}.go")
+
+	var got walkFuncCalls
+	if err := p.Glob(got.walkFunc, traceLogOpt, WithFilesystem(fsys)); err != nil {
+		t.Fatalf("Glob(...) = %v", err)
+	}
+
+	// cmd/tool/main.go is a directory, so doesn't match.
+	want := []walkFuncArgs{
+		{Path: "cmd/api/config.go"},
+		{Path: "cmd/api/main.go"},
+		{Path: "cmd/worker/main.go"},
+	}
+	if diff := cmp.Diff(got.calls, want); diff != "" {
+		t.Errorf("walked paths diff (-got +want):\n%s", diff)
+	}
+	if len(fsys.reads) != 0 {
+		t.Errorf("Glob read directories %q, want none", fsys.reads)
+	}
+}
+
+func TestGlob_FinitePathsAgreesWithWalking(t *testing.T) {
+	fsys := fstest.MapFS{
+		"a/x":   {},
+		"a/y/z": {},
+		"a-b":   {},
+		"c/d":   {},
+		"c/e":   {},
+		"f":     {},
+	}
+	tests := []struct {
+		pattern string
+		skip    string // the callback returns fs.SkipDir for this path
+	}{
+		{pattern: "{a/x,a-b}"},
+		{pattern: "{a-b,a/,a/y/,a/y/z,f}"},
+		{pattern: "{a/,a/x,a/y/z,a-b}", skip: "a"},
+		{pattern: "{c/d,c/e,f}", skip: "c/d"},
+		{pattern: "{a/x,a/y/z,c/d,f}", skip: "a/x"},
+		{pattern: "{a-b,c/d,f}", skip: "a-b"},
+	}
+
+	for _, test := range tests {
+		p := MustParse(test.pattern)
+		if _, ok := p.Paths(); !ok {
+			t.Fatalf("Parse(%q).Paths() ok = false", test.pattern)
+		}
+
+		// Not traversing symlinks means walking rather than stat-ing.
+		var got, want []string
+		record := func(calls *[]string) fs.WalkDirFunc {
+			return func(path string, d fs.DirEntry, err error) error {
+				*calls = append(*calls, path)
+				if path == test.skip {
+					return fs.SkipDir
+				}
+				return nil
+			}
+		}
+		if err := p.Glob(record(&got), traceLogOpt, WithFilesystem(fsys)); err != nil {
+			t.Fatalf("Glob(%q) = %v", test.pattern, err)
+		}
+		if err := p.Glob(record(&want), traceLogOpt, WithFilesystem(fsys), TraverseSymlinks(false)); err != nil {
+			t.Fatalf("Glob(%q, TraverseSymlinks(false)) = %v", test.pattern, err)
+		}
+		if len(want) == 0 {
+			t.Errorf("%q matches nothing in the test filesystem", test.pattern)
+		}
+		if diff := cmp.Diff(got, want); diff != "" {
+			t.Errorf("%q walked paths diff (-got +want):\n%s", test.pattern, diff)
+		}
+	}
+}
+
+func TestMultiGlob_FinitePaths(t *testing.T) {
+	patterns := mustMultiParse(t,
+		"fixtures/a/b/{cad,cod}/{m,n}",
+		"fixtures/a/b/{cod,cid}/erf/{h,i}/",
+		"fixtures/a/b/cod/**/m",
+	)
+
+	var got walkFuncCalls
+	if err := MultiGlob(context.Background(), patterns, got.walkFunc, traceLogOpt); err != nil {
+		t.Fatalf("MultiGlob(...) = %v", err)
+	}
+	got.sortCalls()
+
+	want := []walkFuncArgs{
+		{Path: "fixtures/a/b/cad/m"},
+		{Path: "fixtures/a/b/cid/erf/h"},
+		{Path: "fixtures/a/b/cid/erf/i"},
+		{Path: "fixtures/a/b/cod/erf/h"},
+		{Path: "fixtures/a/b/cod/erf/h/k/m"},
+		{Path: "fixtures/a/b/cod/erf/h/k/n/m"},
+		{Path: "fixtures/a/b/cod/erf/i"},
+		{Path: "fixtures/a/b/cod/erf/i/m"},
+		{Path: "fixtures/a/b/cod/erf/i/n/m"},
+	}
+	if diff := cmp.Diff(got.calls, want); diff != "" {
+		t.Errorf("walked paths diff (-got +want):\n%s", diff)
+	}
+}
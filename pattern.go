@@ -3,7 +3,9 @@ package zzglob
 import (
 	"fmt"
 	"io"
+	"slices"
 	"strings"
+	"sync"
 )
 
 // Pattern is a parsed glob pattern.
@@ -12,6 +14,18 @@ type Pattern struct {
 	root    string
 	initial *state
 
+	// Matches the remainder of the path after the root. The states are
+	// numbered when the pattern is parsed, and the DFA states are built
+	// lazily while matching. Nil if initial is nil.
+	dfa *lazyDFA
+
+	// The pattern after the root, as tokens, for building the capturing
+	// state machine (lazily, by captureMachine).
+	body        tokens
+	captureOnce sync.Once
+	capture     *state
+	groups      int
+
 	// For debugging (e.g. WriteDot, String).
 	inputPattern string
 	inputConfig  parseConfig
@@ -29,7 +43,16 @@ func Parse(pattern string, opts ...ParseOption) (*Pattern, error) {
 	tks := tokenise(pattern, &cfg)
 
 	// Preprocessing, for example replace ~/ with homedir.
-	*tks = preprocess(*tks, cfg.expandTilde)
+	*tks = preprocess(*tks, &cfg, strings.HasPrefix(pattern, "~"))
+
+	// Slash-less patterns match at any depth?
+	if cfg.matchBase {
+		sep := "/"
+		if cfg.swapSlashes {
+			sep = `\`
+		}
+		*tks = matchBase(*tks, strings.HasPrefix(pattern, sep))
+	}
 
 	// If the pattern is all literals, then it's a specific path.
 	if root := tks.allLiteral(); root != "" {
@@ -45,27 +68,72 @@ func Parse(pattern string, opts ...ParseOption) (*Pattern, error) {
 	root := findRoot(tks)
 
 	// Convert the rest of the sequence into a state machine.
-	initial, terminal, _, err := parseSequence(tks, parserInsideNothing)
+	body := slices.Clone(*tks)
+	initial, err := buildMachine(tks, &cfg)
 	if err != nil {
 		return nil, err
 	}
 
-	// The terminal state is accepting.
-	terminal.Accept = true
-
-	// Remove redundant nil edges, where possible. This should only ever remove
-	// edges and possibly redundant intermediate states.
-	reduce(initial)
-
 	// Done! Here's the machine.
 	return &Pattern{
 		root:         root,
 		initial:      initial,
+		dfa:          newLazyDFA(initial),
+		body:         body,
 		inputPattern: pattern,
 		inputConfig:  cfg,
 	}, nil
 }
 
+// buildMachine converts a token sequence into a state machine.
+func buildMachine(tks *tokens, cfg *parseConfig) (*state, error) {
+	initial, terminal, _, err := parseSequence(tks, parserInsideNothing, cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	// The terminal state is accepting.
+	terminal.Accept = true
+
+	// Make every edge match case-insensitively?
+	if cfg.caseInsensitive {
+		foldCase(initial)
+	}
+
+	// Stop wildcards matching a leading . in each segment?
+	if !cfg.matchDotfiles {
+		initial = hideDotfiles(initial)
+	}
+
+	// Remove redundant nil edges, where possible. This should only ever remove
+	// edges and possibly redundant intermediate states.
+	reduce(initial)
+	return initial, nil
+}
+
+// captureMachine returns a state machine for the pattern that has tagged
+// edges for capture groups, and the number of groups. p.initial must not be
+// nil.
+func (p *Pattern) captureMachine() (*state, int) {
+	p.captureOnce.Do(func() {
+		if p.body == nil {
+			// Not parsed (e.g. made by And), so there are no groups.
+			p.capture = p.initial
+			return
+		}
+		cfg := p.inputConfig
+		cfg.groups = new(int)
+		tks := slices.Clone(p.body)
+		initial, err := buildMachine(&tks, &cfg)
+		if err != nil {
+			// It parsed fine the first time, so this shouldn't happen.
+			panic(fmt.Sprintf("reparsing %q with capture groups: %v", p.inputPattern, err))
+		}
+		p.capture, p.groups = initial, *cfg.groups
+	})
+	return p.capture, p.groups
+}
+
 // MustParse calls Parse, and panics if unable to parse the pattern.
 func MustParse(pattern string) *Pattern {
 	p, err := Parse(pattern)
@@ -176,8 +244,8 @@ func reduce(initial *state) {
 		for i := range s.Out {
 			e := &s.Out[i]
 
-			// These optimisations only apply if the destination state is valid
-			// and has out-degree 1.
+			// These optimisations only apply if the destination state is valid,
+			// not accepting (which would be skipped over), and has out-degree 1.
 			for {
 				// If e has nil Expr, then replace both the expression and
 				// target of e with the next edge:
@@ -185,7 +253,7 @@ func reduce(initial *state) {
 				// s --e(<nil>)--> s' --e'--> s''
 				//   becomes
 				// s --e'--> s''
-				if e.State != nil && len(e.State.Out) == 1 && e.Expr == nil {
+				if e.State != nil && !e.State.Accept && len(e.State.Out) == 1 && e.Expr == nil && e.Tag == 0 {
 					*e = e.State.Out[0]
 					continue
 				}
@@ -196,7 +264,7 @@ func reduce(initial *state) {
 				// s --e--> s' --e'(<nil>)--> s''
 				//   becomes
 				// s --e--> s''
-				if e.State != nil && len(e.State.Out) == 1 && e.State.Out[0].Expr == nil {
+				if e.State != nil && !e.State.Accept && len(e.State.Out) == 1 && e.State.Out[0].Expr == nil && e.State.Out[0].Tag == 0 {
 					e.State = e.State.Out[0].State
 					continue
 				}
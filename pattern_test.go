@@ -1,6 +1,7 @@
 package zzglob
 
 import (
+	"fmt"
 	"io"
 	"testing"
 
@@ -66,9 +67,15 @@ func TestWriteDotSmoke(t *testing.T) {
 	tests := []string{
 		"a/b",
 		"a/b*c/d?e/{f,g}/[ij]/**/[^k]l",
+		"a/[a-z_]/[^0-9a-f]",
+		"a/[[:alpha:]\\p{Han}]/[^[:digit:]\\P{L}x-z]",
+		"a/<1-100>/<5->",
+		"a/!(*_test).go/@(b|c)",
+		"shard-{00..15}/{a..f}",
+		"src/**{0,2}/*/{1,}x",
 	}
 	for _, pattern := range tests {
-		p, err := Parse(pattern, WithSwapSlashes(false))
+		p, err := Parse(pattern, WithSwapSlashes(false), AllowExtGlob(true), AllowBraceSequence(true), AllowNumericRange(true), AllowSegmentRepetition(true), AllowNamedCharClass(true))
 		if err != nil {
 			t.Fatalf("Parse(%q) error = %v", pattern, err)
 		}
@@ -78,6 +85,122 @@ func TestWriteDotSmoke(t *testing.T) {
 	}
 }
 
+func TestParse_CharClassErrors(t *testing.T) {
+	tests := []string{
+		"[z-a]",
+		"[^9-0]",
+		"[a-c",
+		"[^a-",
+		"[[:alpha:]",
+		"[[:nope:]]",
+		"[\\p{Nope}]",
+	}
+	for _, pattern := range tests {
+		if _, err := Parse(pattern, WithSwapSlashes(false), AllowNamedCharClass(true)); err == nil {
+			t.Errorf("Parse(%q) error = %v, want non-nil error", pattern, err)
+		}
+	}
+}
+
+func TestParse_AllowNamedCharClassDisabled(t *testing.T) {
+	pattern := "[[:alpha:]]"
+	// Disabled is the default.
+	for _, opts := range [][]ParseOption{
+		{WithSwapSlashes(false)},
+		{WithSwapSlashes(false), AllowNamedCharClass(false)},
+	} {
+		p, err := Parse(pattern, opts...)
+		if err != nil {
+			t.Fatalf("Parse(%q) error = %v", pattern, err)
+		}
+		// [[:alpha:] is a char class, and the second ] is a literal.
+		for path, want := range map[string]bool{
+			"a]": true,
+			":]": true,
+			"b]": false,
+			"a":  false,
+		} {
+			if got := p.Match(path); got != want {
+				t.Errorf("p.Match(%q) = %t, want %t", path, got, want)
+			}
+		}
+	}
+}
+
+func TestParse_BraceSequenceIsCompact(t *testing.T) {
+	pattern := "{0..99999999}"
+	p, err := Parse(pattern, AllowBraceSequence(true))
+	if err != nil {
+		t.Fatalf("Parse(%q) error = %v", pattern, err)
+	}
+	states, edges := 0, 0
+	visit(p.initial, func(s *state) {
+		states++
+		edges += len(s.Out)
+	})
+	if states > 100 || edges > 100 {
+		t.Errorf("Parse(%q) has %d states and %d edges, want at most 100 of each", pattern, states, edges)
+	}
+}
+
+func TestParse_BraceSequenceErrors(t *testing.T) {
+	tests := []string{
+		"{1..f}",
+		"{1..99999999999999999999}",
+	}
+	for _, pattern := range tests {
+		if _, err := Parse(pattern, AllowBraceSequence(true)); err == nil {
+			t.Errorf("Parse(%q) error = %v, want non-nil error", pattern, err)
+		}
+	}
+}
+
+func TestParse_NumericRangeErrors(t *testing.T) {
+	tests := []string{
+		"<10-1>",
+		"<1-99999999999999999999>",
+	}
+	for _, pattern := range tests {
+		if _, err := Parse(pattern, AllowNumericRange(true)); err == nil {
+			t.Errorf("Parse(%q) error = %v, want non-nil error", pattern, err)
+		}
+	}
+}
+
+func TestParse_SegmentRepetitionErrors(t *testing.T) {
+	tests := []string{
+		"a/{3,1}",
+		"**{3,1}",
+		"a/{1000}",
+		"**{0,1000}",
+	}
+	for _, pattern := range tests {
+		if _, err := Parse(pattern, AllowSegmentRepetition(true)); err == nil {
+			t.Errorf("Parse(%q) error = %v, want non-nil error", pattern, err)
+		}
+	}
+}
+
+func TestParse_SegmentRepetitionRoot(t *testing.T) {
+	tests := []struct {
+		pattern, wantRoot string
+	}{
+		{"src/**{0,2}/*.go", "src/"},
+		{"a/b/*/{1,3}", "a/b/"},
+		{"a/b/{1,3}", "a/"},
+		{"a/{1,3}", ""},
+	}
+	for _, test := range tests {
+		p, err := Parse(test.pattern, AllowSegmentRepetition(true), WithSwapSlashes(false))
+		if err != nil {
+			t.Fatalf("Parse(%q) error = %v", test.pattern, err)
+		}
+		if got, want := p.root, test.wantRoot; got != want {
+			t.Errorf("Parse(%q).root = %q, want %q", test.pattern, got, want)
+		}
+	}
+}
+
 func TestParse_SwapSlashes(t *testing.T) {
 	// Contains no operators - slash translation only
 	src := `C:\Windows\Media\Passport.mid`
@@ -102,26 +225,26 @@ func TestParse_TildeSlashPrefix(t *testing.T) {
 		{
 			expandTilde: true,
 			input:       "~/a",
-			match:       string(homeDir()) + "a",
+			match:       string(homeDir("", defaultHomeDirResolver)) + "a",
 			noMatch:     "~/a",
 		},
 		{
 			expandTilde: false,
 			input:       "~/a",
 			match:       "~/a",
-			noMatch:     string(homeDir()) + "a",
+			noMatch:     string(homeDir("", defaultHomeDirResolver)) + "a",
 		},
 		{
 			expandTilde: true,
 			input:       "a/~",
 			match:       "a/~",
-			noMatch:     "a" + string(homeDir()),
+			noMatch:     "a" + string(homeDir("", defaultHomeDirResolver)),
 		},
 		{
 			expandTilde: false,
 			input:       "a/~",
 			match:       "a/~",
-			noMatch:     "a" + string(homeDir()),
+			noMatch:     "a" + string(homeDir("", defaultHomeDirResolver)),
 		},
 	}
 	for _, test := range tests {
@@ -140,6 +263,54 @@ func TestParse_TildeSlashPrefix(t *testing.T) {
 	}
 }
 
+func TestParse_TildeForms(t *testing.T) {
+	dirs := map[string]string{
+		"":      "/home/me",
+		"alice": "/home/alice/",
+		"+":     "/work/here",
+		"-":     "/work/there",
+		"root":  "/",
+	}
+	resolve := func(user string) (string, error) {
+		if dir, ok := dirs[user]; ok {
+			return dir, nil
+		}
+		return "", fmt.Errorf("unknown user %q", user)
+	}
+
+	tests := []struct {
+		input   string
+		match   string
+		noMatch string
+	}{
+		{input: "~/a", match: "/home/me/a", noMatch: "~/a"},
+		{input: "~", match: "~", noMatch: "/home/me"}, // needs a / after it
+		{input: "~alice/*.txt", match: "/home/alice/x.txt", noMatch: "/home/me/x.txt"},
+		{input: "~alice", match: "~alice", noMatch: "/home/alice"},
+		{input: "~+/b", match: "/work/here/b", noMatch: "~+/b"},
+		{input: "~-/b", match: "/work/there/b", noMatch: "/work/here/b"},
+		{input: "~root/", match: "/", noMatch: "~root/"},
+		{input: "~root/etc", match: "/etc", noMatch: "~root/etc"},
+		{input: "~bob/a", match: "~bob/a", noMatch: "/home/bob/a"},
+		{input: "~a*/b", match: "~ab/b", noMatch: "/home/alice/b"},
+		{input: "a/~alice", match: "a/~alice", noMatch: "a/home/alice"},
+	}
+	for _, test := range tests {
+		t.Run(test.input, func(t *testing.T) {
+			p, err := Parse(test.input, WithHomeDirResolver(resolve))
+			if err != nil {
+				t.Fatalf("Parse(%q) error = %v", test.input, err)
+			}
+			if got, want := p.Match(test.match), true; got != want {
+				t.Errorf("p.Match(%q) = %t, want %t", test.match, got, want)
+			}
+			if got, want := p.Match(test.noMatch), false; got != want {
+				t.Errorf("p.Match(%q) = %t, want %t", test.noMatch, got, want)
+			}
+		})
+	}
+}
+
 func FuzzParseMatch(f *testing.F) {
 	f.Fuzz(func(t *testing.T, pattern, path string,
 		allowEscaping, allowQuestion, allowStar, allowDoubleStar, allowAlternation, allowCharClass, swapSlashes, expandTilde bool) {
@@ -161,3 +332,102 @@ func FuzzParseMatch(f *testing.F) {
 		_ = p.Match(path)
 	})
 }
+
+func TestParse_ExpandEnv(t *testing.T) {
+	env := map[string]string{
+		"XDG_CACHE_HOME": "/home/me/.cache",
+		"GOPATH":         "/home/me/go/",
+		"WILD":           "a*b",
+		"EMPTY":          "",
+		"TILDE":          "~",
+	}
+	lookup := func(key string) (string, bool) {
+		v, ok := env[key]
+		return v, ok
+	}
+
+	tests := []struct {
+		input    string
+		wantRoot string
+		match    string
+		noMatch  string
+	}{
+		{
+			input:    "$XDG_CACHE_HOME/**/*.tmp",
+			wantRoot: "/home/me/.cache/",
+			match:    "/home/me/.cache/x/y.tmp",
+			noMatch:  "$XDG_CACHE_HOME/y.tmp",
+		},
+		{
+			input:    "${GOPATH}/pkg/mod/**",
+			wantRoot: "/home/me/go/pkg/mod/",
+			match:    "/home/me/go/pkg/mod/a/b",
+			noMatch:  "/home/me/go//pkg/mod/a/b",
+		},
+		{
+			input:    "${NOPE:-/tmp}/*.log",
+			wantRoot: "/tmp/",
+			match:    "/tmp/a.log",
+			noMatch:  "/a.log",
+		},
+		{
+			input:    "${EMPTY:-/var}/*.log",
+			wantRoot: "/var/",
+			match:    "/var/a.log",
+			noMatch:  "/a.log",
+		},
+		{
+			input:    "/x/$WILD/*",
+			wantRoot: "/x/a*b/",
+			match:    "/x/a*b/c",
+			noMatch:  "/x/acb/c",
+		},
+		{
+			input:    "/x/$NOPE*",
+			wantRoot: "/x/",
+			match:    "/x/abc",
+			noMatch:  "/y/abc",
+		},
+		{
+			input:    "$TILDE/*",
+			wantRoot: "~/",
+			match:    "~/a",
+			noMatch:  "/home/me/a",
+		},
+		{
+			input:    "${NOPE:-~/.cache}/*",
+			wantRoot: "~/.cache/",
+			match:    "~/.cache/a",
+			noMatch:  "/home/me/.cache/a",
+		},
+		{
+			input:    `\$WILD/$ /*`,
+			wantRoot: "$WILD/$ /",
+			match:    "$WILD/$ /a",
+			noMatch:  "a*b/$ /a",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.input, func(t *testing.T) {
+			p, err := Parse(test.input,
+				ExpandEnv(true),
+				WithEnvLookup(lookup),
+				WithHomeDirResolver(func(string) (string, error) { return "/home/me", nil }),
+				WithSwapSlashes(false),
+				AllowEscaping(true),
+			)
+			if err != nil {
+				t.Fatalf("Parse(%q) error = %v", test.input, err)
+			}
+			if got, want := p.root, test.wantRoot; got != want {
+				t.Errorf("p.root = %q, want %q", got, want)
+			}
+			if got, want := p.Match(test.match), true; got != want {
+				t.Errorf("p.Match(%q) = %t, want %t", test.match, got, want)
+			}
+			if got, want := p.Match(test.noMatch), false; got != want {
+				t.Errorf("p.Match(%q) = %t, want %t", test.noMatch, got, want)
+			}
+		})
+	}
+}
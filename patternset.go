@@ -0,0 +1,299 @@
+package zzglob
+
+import (
+	"errors"
+	"io/fs"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// PatternSet matches paths against many patterns at once. The patterns are
+// merged into a single automaton, whose accepting states are tagged with the
+// indexes of the patterns they belong to, so matching a path against the whole
+// set costs about the same as matching it against one pattern. Pattern roots
+// are merged into a trie, so patterns with similar roots share states.
+// A PatternSet is safe for concurrent use.
+type PatternSet struct {
+	patterns []*Pattern
+
+	// initial matches whole paths (including each pattern root).
+	initial *state
+
+	// accepts maps each accepting state to the indexes of the patterns it
+	// accepts for.
+	accepts map[*state][]int
+
+	// owners maps every state to the indexes of the patterns that it is
+	// part of. (States matching roots can be part of many patterns.)
+	owners map[*state][]int
+
+	// The directories to walk from, when globbing.
+	roots []setRoot
+
+	dfa *lazyDFA
+
+	// tags maps DFA program state ids to pattern indexes.
+	tags [][]int
+}
+
+// NewPatternSet returns a PatternSet containing the patterns. The index of
+// each pattern in the arguments is its index in the results of Match.
+func NewPatternSet(patterns ...*Pattern) *PatternSet {
+	ps := &PatternSet{
+		patterns: slices.Clone(patterns),
+		initial:  &state{},
+		accepts:  make(map[*state][]int),
+		owners:   make(map[*state][]int),
+	}
+
+	// Roots (case-sensitive ones, at least) are shared in a trie.
+	trie := make(map[*state]map[rune]*state)
+	for i, p := range patterns {
+		end := ps.addRoot(trie, i, p.root, p.inputConfig.caseInsensitive)
+		if p.initial == nil {
+			end.Accept = true
+			ps.accepts[end] = append(ps.accepts[end], i)
+			continue
+		}
+		end.Out = append(end.Out, edge{State: p.initial})
+		visit(p.initial, func(s *state) {
+			ps.owners[s] = append(ps.owners[s], i)
+			if s.Accept {
+				ps.accepts[s] = append(ps.accepts[s], i)
+			}
+		})
+	}
+
+	ps.dfa = newLazyDFA(ps.initial)
+	ps.tags = make([][]int, len(ps.dfa.prog.src))
+	for id, s := range ps.dfa.prog.src {
+		ps.tags[id] = ps.accepts[s]
+	}
+
+	ps.roots = setRoots(patterns)
+	return ps
+}
+
+// addRoot adds states for matching the root of pattern i from the initial
+// state, and returns the state reached. Case-insensitive roots aren't shared.
+func (ps *PatternSet) addRoot(trie map[*state]map[rune]*state, i int, root string, fold bool) *state {
+	cur := ps.initial
+	ps.owners[cur] = append(ps.owners[cur], i)
+	for _, r := range root {
+		if fold {
+			next := &state{}
+			for _, x := range foldRanges(literalExp(r).runeRanges()) {
+				cur.Out = append(cur.Out, edge{Expr: x.exp(), State: next})
+			}
+			cur = next
+			ps.owners[cur] = append(ps.owners[cur], i)
+			continue
+		}
+		children := trie[cur]
+		if children == nil {
+			children = make(map[rune]*state)
+			trie[cur] = children
+		}
+		next := children[r]
+		if next == nil {
+			next = &state{}
+			children[r] = next
+			cur.Out = append(cur.Out, edge{Expr: literalExp(r), State: next})
+		}
+		cur = next
+		ps.owners[cur] = append(ps.owners[cur], i)
+	}
+	return cur
+}
+
+// setRoot is a directory to walk from when globbing a PatternSet.
+type setRoot struct {
+	dir  string // a prefix of some pattern roots (empty, or ending in /)
+	fold bool   // whether any of those patterns is case-insensitive
+}
+
+// setRoots groups the patterns by the anchor of their root (volume name,
+// leading slashes, and leading .. segments), and finds the longest common
+// directory of each group.
+func setRoots(patterns []*Pattern) []setRoot {
+	type group struct {
+		prefix string
+		fold   bool
+	}
+	groups := make(map[string]*group)
+	var anchors []string
+	for _, p := range patterns {
+		// A root that is itself a directory (ends with /) can only be
+		// matched from its parent.
+		root := p.root
+		if p.initial == nil {
+			root = strings.TrimSuffix(root, "/")
+		}
+		anchor := rootAnchor(root)
+		g := groups[anchor]
+		if g == nil {
+			g = &group{prefix: root}
+			groups[anchor] = g
+			anchors = append(anchors, anchor)
+		}
+		g.fold = g.fold || p.inputConfig.caseInsensitive
+		g.prefix = commonPrefix(g.prefix, root)
+	}
+	slices.Sort(anchors)
+
+	roots := make([]setRoot, 0, len(anchors))
+	for _, anchor := range anchors {
+		g := groups[anchor]
+		dir := g.prefix[:strings.LastIndex(g.prefix, "/")+1]
+		if len(dir) < len(anchor) {
+			dir = anchor
+		}
+		roots = append(roots, setRoot{dir: dir, fold: g.fold})
+	}
+	return roots
+}
+
+// rootAnchor returns the volume name, leading slashes, and leading .. segments
+// of root. Roots with different anchors can't be reached by walking from one
+// common directory (e.g. ../x isn't within .).
+func rootAnchor(root string) string {
+	vol := filepath.VolumeName(root)
+	rest := strings.TrimLeft(root[len(vol):], "/")
+	for strings.HasPrefix(rest, "../") {
+		rest = strings.TrimLeft(rest[len("../"):], "/")
+	}
+	return root[:len(root)-len(rest)]
+}
+
+// commonPrefix returns the longest common prefix of a and b.
+func commonPrefix(a, b string) string {
+	n := min(len(a), len(b))
+	for i := 0; i < n; i++ {
+		if a[i] != b[i] {
+			return a[:i]
+		}
+	}
+	return a[:n]
+}
+
+// Len returns the number of patterns in the set.
+func (ps *PatternSet) Len() int { return len(ps.patterns) }
+
+// Pattern returns the pattern with index i.
+func (ps *PatternSet) Pattern(i int) *Pattern { return ps.patterns[i] }
+
+// Match returns the indexes (in increasing order) of the patterns that match
+// the path, or nil if none match. As with [Pattern.Match], directories should
+// be given a trailing slash.
+func (ps *PatternSet) Match(path string) []int {
+	ds := ps.dfa.final(path)
+	if ds == nil || !ds.accept {
+		return nil
+	}
+	var idx []int
+	for _, id := range ds.set {
+		idx = append(idx, ps.tags[id]...)
+	}
+	slices.Sort(idx)
+	return slices.Compact(idx)
+}
+
+// MatchFirst returns the lowest index of the patterns that match the path, or
+// -1 if none match.
+func (ps *PatternSet) MatchFirst(path string) int {
+	first := -1
+	ps.eachMatch(path, func(i int) {
+		if first < 0 || i < first {
+			first = i
+		}
+	})
+	return first
+}
+
+// MatchLast returns the highest index of the patterns that match the path, or
+// -1 if none match.
+func (ps *PatternSet) MatchLast(path string) int {
+	last := -1
+	ps.eachMatch(path, func(i int) {
+		last = max(last, i)
+	})
+	return last
+}
+
+// eachMatch calls f with the index of each pattern that matches the path
+// (possibly more than once, in no particular order).
+func (ps *PatternSet) eachMatch(path string, f func(int)) {
+	ds := ps.dfa.final(path)
+	if ds == nil || !ds.accept {
+		return
+	}
+	for _, id := range ds.set {
+		for _, i := range ps.tags[id] {
+			f(i)
+		}
+	}
+}
+
+// Glob globs for files matching any pattern in the set, in a single walk for
+// each distinct root. Directories are only walked if at least one pattern
+// could match something within them. Use Match (or MatchFirst, or MatchLast)
+// in the callback to find which patterns matched each path.
+func (ps *PatternSet) Glob(f fs.WalkDirFunc, opts ...GlobOption) error {
+	if f == nil {
+		return errors.New("nil WalkDirFunc in arg to PatternSet.Glob")
+	}
+
+	cfg := &globConfig{
+		translateSlashes: true,
+		traverseSymlinks: true,
+		callback:         f,
+	}
+	for _, o := range opts {
+		if o == nil {
+			continue
+		}
+		o(cfg)
+	}
+
+	return ps.glob(cfg, nil)
+}
+
+// glob walks from each root of the set. decide is optional (see globState).
+func (ps *PatternSet) glob(cfg *globConfig, decide func(stateSet) (bool, bool)) error {
+	cfg.watchSkipAll()
+	for _, root := range ps.roots {
+		dirs := []string{path.Clean(root.dir)}
+		if root.fold {
+			// As with Pattern.Glob, walk from every directory that matches.
+			dirs = resolveFold(dirs[0], cfg.readDir)
+		}
+		for _, dir := range dirs {
+			states := matchSegment(singleton(ps.initial), dirPrefix(dir))
+			if len(states) == 0 {
+				continue
+			}
+			if err := globFrom(cfg, dir, states, decide); err != nil {
+				return err
+			}
+			if cfg.skippedAll.Load() {
+				return nil
+			}
+		}
+	}
+	return nil
+}
+
+// dirPrefix returns the prefix of the paths within the clean directory dir
+// (empty for ., otherwise ending in /).
+func dirPrefix(dir string) string {
+	switch {
+	case dir == ".":
+		return ""
+	case strings.HasSuffix(dir, "/"):
+		return dir
+	default:
+		return dir + "/"
+	}
+}
@@ -0,0 +1,390 @@
+package zzglob
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+	"testing/fstest"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestPatternSet_Match(t *testing.T) {
+	docs, err := Parse("Docs/*", CaseInsensitive(true))
+	if err != nil {
+		t.Fatalf("Parse(Docs/*, CaseInsensitive(true)) = %v", err)
+	}
+	patterns := []*Pattern{
+		MustParse("src/**/*.go"),      // 0
+		MustParse("src/**/*_test.go"), // 1
+		MustParse("src/vendor/**"),    // 2
+		MustParse("docs/*.md"),        // 3
+		MustParse("README.md"),        // 4
+		MustParse("src/**/*.go"),      // 5 (same as 0)
+		MustParse("/etc/*.conf"),      // 6
+		docs,                          // 7
+	}
+	ps := NewPatternSet(patterns...)
+
+	tests := []struct {
+		path        string
+		want        []int
+		first, last int
+	}{
+		{"src/main.go", []int{0, 5}, 0, 5},
+		{"src/a/b_test.go", []int{0, 1, 5}, 0, 5},
+		{"src/vendor/x/y.go", []int{0, 2, 5}, 0, 5},
+		{"src/vendor/README", []int{2}, 2, 2},
+		{"docs/intro.md", []int{3, 7}, 3, 7},
+		{"DOCS/intro.txt", []int{7}, 7, 7},
+		{"README.md", []int{4}, 4, 4},
+		{"README.txt", nil, -1, -1},
+		{"/etc/hosts.conf", []int{6}, 6, 6},
+		{"etc/hosts.conf", nil, -1, -1},
+		{"", nil, -1, -1},
+	}
+
+	for _, test := range tests {
+		if diff := cmp.Diff(ps.Match(test.path), test.want); diff != "" {
+			t.Errorf("ps.Match(%q) diff (-got +want):\n%s", test.path, diff)
+		}
+		if got := ps.MatchFirst(test.path); got != test.first {
+			t.Errorf("ps.MatchFirst(%q) = %d, want %d", test.path, got, test.first)
+		}
+		if got := ps.MatchLast(test.path); got != test.last {
+			t.Errorf("ps.MatchLast(%q) = %d, want %d", test.path, got, test.last)
+		}
+
+		// The set should agree with the individual patterns.
+		var want []int
+		for i, p := range patterns {
+			if p.Match(test.path) {
+				want = append(want, i)
+			}
+		}
+		if diff := cmp.Diff(ps.Match(test.path), want); diff != "" {
+			t.Errorf("ps.Match(%q) disagrees with Pattern.Match (-set +patterns):\n%s", test.path, diff)
+		}
+	}
+}
+
+func TestPatternSet_Empty(t *testing.T) {
+	ps := NewPatternSet()
+	if got := ps.Match("a"); got != nil {
+		t.Errorf("NewPatternSet().Match(a) = %v, want nil", got)
+	}
+
+	var got walkFuncCalls
+	if err := ps.Glob(got.walkFunc, WithFilesystem(fstest.MapFS{"a": {}})); err != nil {
+		t.Fatalf("ps.Glob(...) = %v", err)
+	}
+	if len(got.calls) != 0 {
+		t.Errorf("NewPatternSet().Glob called back with %v, want no calls", got.calls)
+	}
+}
+
+func TestPatternSet_SharesRoots(t *testing.T) {
+	var patterns []*Pattern
+	for i := 0; i < 100; i++ {
+		patterns = append(patterns, MustParse(fmt.Sprintf("some/long/shared/root/%d/*.txt", i)))
+	}
+	ps := NewPatternSet(patterns...)
+
+	// The shared root should only have states once.
+	count := 0
+	visit(ps.initial, func(*state) { count++ })
+	if max := 100 * 10; count > max {
+		t.Errorf("combined automaton has %d states, want at most %d", count, max)
+	}
+	if got, want := ps.MatchFirst("some/long/shared/root/42/x.txt"), 42; got != want {
+		t.Errorf("ps.MatchFirst(...) = %d, want %d", got, want)
+	}
+}
+
+func TestPatternSet_Glob(t *testing.T) {
+	fsys := &readDirRecorder{
+		FS: fstest.MapFS{
+			"src/a.go":             {},
+			"src/a_test.go":        {},
+			"src/lib/b.go":         {},
+			"src/lib/b.c":          {},
+			"src/testdata/x.go":    {},
+			"docs/index.md":        {},
+			"docs/img/logo.png":    {},
+			"build/out/a.o":        {},
+			"build/out/deep/b.o":   {},
+			"node_modules/x/y.js":  {},
+			"README.md":            {},
+			"LICENSE":              {},
+			"src/lib/vendor/z.go":  {},
+			"src/lib/vendor/z.txt": {},
+		},
+	}
+
+	ps := NewPatternSet(
+		MustParse("src/**/*.go"),
+		MustParse("docs/*.md"),
+		MustParse("README.md"),
+		MustParse("build/out/"),
+	)
+
+	var got walkFuncCalls
+	if err := ps.Glob(got.walkFunc, traceLogOpt, WithFilesystem(fsys)); err != nil {
+		t.Fatalf("ps.Glob(...) = %v", err)
+	}
+
+	want := []walkFuncArgs{
+		{Path: "README.md"},
+		{Path: "build/out"},
+		{Path: "docs/index.md"},
+		{Path: "src/a.go"},
+		{Path: "src/a_test.go"},
+		{Path: "src/lib/b.go"},
+		{Path: "src/lib/vendor/z.go"},
+		{Path: "src/testdata/x.go"},
+	}
+	if diff := cmp.Diff(got.calls, want); diff != "" {
+		t.Errorf("walked paths diff (-got +want):\n%s", diff)
+	}
+
+	// Only one walk, and only directories that could contain a match. The
+	// names in . and build can only be README.md, build, docs, src, and out,
+	// so they are stat-ed instead of read.
+	wantReads := []string{"docs", "src", "src/lib", "src/lib/vendor", "src/testdata"}
+	if diff := cmp.Diff(fsys.reads, wantReads); diff != "" {
+		t.Errorf("read directories diff (-got +want):\n%s", diff)
+	}
+}
+
+func TestPatternSet_GlobCommonRoot(t *testing.T) {
+	fsys := &readDirRecorder{
+		FS: fstest.MapFS{
+			"a/b/c/x.txt": {},
+			"a/b/d/y.txt": {},
+			"a/b/e/z.txt": {},
+			"a/q.txt":     {},
+		},
+	}
+
+	ps := NewPatternSet(
+		MustParse("a/b/c/*.txt"),
+		MustParse("a/b/d*/*.txt"),
+	)
+
+	var got walkFuncCalls
+	if err := ps.Glob(got.walkFunc, traceLogOpt, WithFilesystem(fsys)); err != nil {
+		t.Fatalf("ps.Glob(...) = %v", err)
+	}
+
+	want := []walkFuncArgs{
+		{Path: "a/b/c/x.txt"},
+		{Path: "a/b/d/y.txt"},
+	}
+	if diff := cmp.Diff(got.calls, want); diff != "" {
+		t.Errorf("walked paths diff (-got +want):\n%s", diff)
+	}
+
+	// The walk starts at the common root.
+	wantReads := []string{"a/b", "a/b/c", "a/b/d"}
+	if diff := cmp.Diff(fsys.reads, wantReads); diff != "" {
+		t.Errorf("read directories diff (-got +want):\n%s", diff)
+	}
+}
+
+// mustParseFold parses a case-insensitive pattern.
+func mustParseFold(t *testing.T, pattern string) *Pattern {
+	t.Helper()
+	p, err := Parse(pattern, CaseInsensitive(true))
+	if err != nil {
+		t.Fatalf("Parse(%q, CaseInsensitive(true)) = %v", pattern, err)
+	}
+	return p
+}
+
+func TestSetRoots(t *testing.T) {
+	tests := []struct {
+		patterns []string
+		want     []setRoot
+	}{
+		{[]string{"a/b/c/*.txt", "a/b/d*/*.txt"}, []setRoot{{dir: "a/b/"}}},
+		{[]string{"a/*.txt", "b/*.txt"}, []setRoot{{dir: ""}}},
+		{[]string{"/etc/*.conf", "*.txt"}, []setRoot{{dir: ""}, {dir: "/etc/"}}},
+		{[]string{"../x/*.txt", "*.txt"}, []setRoot{{dir: ""}, {dir: "../x/"}}},
+		{[]string{"../x/*.txt", "../y/*.txt"}, []setRoot{{dir: "../"}}},
+		{[]string{"../x/*.txt", "../../y/*.txt"}, []setRoot{{dir: "../x/"}, {dir: "../../y/"}}},
+		{[]string{"../*.txt", "../x/*.txt"}, []setRoot{{dir: "../"}}},
+	}
+
+	for _, test := range tests {
+		var patterns []*Pattern
+		for _, p := range test.patterns {
+			patterns = append(patterns, MustParse(p))
+		}
+		if diff := cmp.Diff(setRoots(patterns), test.want, cmp.AllowUnexported(setRoot{})); diff != "" {
+			t.Errorf("setRoots(%q) diff (-got +want):\n%s", test.patterns, diff)
+		}
+	}
+
+	// Case-insensitive roots are kept, to be resolved when globbing.
+	patterns := []*Pattern{
+		mustParseFold(t, "/home/X/**"),
+		MustParse("/home/X/y/*.txt"),
+	}
+	want := []setRoot{{dir: "/home/X/", fold: true}}
+	if diff := cmp.Diff(setRoots(patterns), want, cmp.AllowUnexported(setRoot{})); diff != "" {
+		t.Errorf("setRoots(case-insensitive) diff (-got +want):\n%s", diff)
+	}
+}
+
+func TestPatternSet_GlobCaseInsensitiveRoot(t *testing.T) {
+	fsys := &readDirRecorder{
+		FS: fstest.MapFS{
+			"Home/X/a.txt":   {},
+			"home/x/b.md":    {},
+			"home/x/y/c.txt": {},
+			"other/d.txt":    {},
+		},
+	}
+
+	ps := NewPatternSet(
+		mustParseFold(t, "home/x/*.txt"),
+		mustParseFold(t, "HOME/X/*.md"),
+	)
+
+	var got walkFuncCalls
+	if err := ps.Glob(got.walkFunc, traceLogOpt, WithFilesystem(fsys)); err != nil {
+		t.Fatalf("ps.Glob(...) = %v", err)
+	}
+
+	want := []walkFuncArgs{
+		{Path: "Home/X/a.txt"},
+		{Path: "home/x/b.md"},
+	}
+	if diff := cmp.Diff(got.calls, want); diff != "" {
+		t.Errorf("walked paths diff (-got +want):\n%s", diff)
+	}
+
+	// The roots are resolved, rather than walking everything from . (so
+	// other isn't read).
+	wantReads := []string{".", "Home", "Home/X", "home", "home/x"}
+	if diff := cmp.Diff(fsys.reads, wantReads); diff != "" {
+		t.Errorf("read directories diff (-got +want):\n%s", diff)
+	}
+}
+
+// chdirParentTree creates x/f.txt and bar/g.txt in a temporary directory,
+// and changes to bar for the rest of the test.
+func chdirParentTree(t *testing.T) {
+	t.Helper()
+	dir := t.TempDir()
+	for _, name := range []string{"x/f.txt", "bar/g.txt"} {
+		name = filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(name), 0o755); err != nil {
+			t.Fatalf("os.MkdirAll(...) error = %v", err)
+		}
+		if err := os.WriteFile(name, nil, 0o644); err != nil {
+			t.Fatalf("os.WriteFile(...) error = %v", err)
+		}
+	}
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("os.Getwd() error = %v", err)
+	}
+	t.Cleanup(func() { os.Chdir(wd) })
+	if err := os.Chdir(filepath.Join(dir, "bar")); err != nil {
+		t.Fatalf("os.Chdir(...) error = %v", err)
+	}
+}
+
+func TestPatternSet_GlobParentRoot(t *testing.T) {
+	chdirParentTree(t)
+
+	ps := NewPatternSet(MustParse("../x/*.txt"), MustParse("*.txt"))
+	var got walkFuncCalls
+	if err := ps.Glob(got.walkFunc, traceLogOpt); err != nil {
+		t.Fatalf("ps.Glob(...) = %v", err)
+	}
+	got.sortCalls()
+
+	// ../x isn't within ., so it is walked separately.
+	want := []walkFuncArgs{
+		{Path: filepath.FromSlash("../x/f.txt")},
+		{Path: "g.txt"},
+	}
+	if diff := cmp.Diff(got.calls, want); diff != "" {
+		t.Errorf("walked paths diff (-got +want):\n%s", diff)
+	}
+}
+
+func TestPatternSet_GlobSkipAll(t *testing.T) {
+	chdirParentTree(t)
+
+	// ../x and . are walked separately, but fs.SkipAll stops both.
+	patterns := []*Pattern{MustParse("../x/*.txt"), MustParse("*.txt")}
+	globs := map[string]func(fs.WalkDirFunc) error{
+		"PatternSet": func(f fs.WalkDirFunc) error {
+			return NewPatternSet(patterns...).Glob(f, traceLogOpt)
+		},
+		"RuleSet": func(f fs.WalkDirFunc) error {
+			return NewRuleSet(Include(patterns[0]), Include(patterns[1])).Glob(f, traceLogOpt)
+		},
+	}
+	for name, glob := range globs {
+		var got []string
+		err := glob(func(path string, d fs.DirEntry, err error) error {
+			got = append(got, path)
+			return fs.SkipAll
+		})
+		if err != nil {
+			t.Fatalf("%s.Glob(...) = %v", name, err)
+		}
+		if len(got) != 1 {
+			t.Errorf("%s.Glob(...) called back with %q, want only one path", name, got)
+		}
+	}
+}
+
+func TestPatternSet_GlobAgreesWithMatch(t *testing.T) {
+	fsys := deepMapFS(4, 2)
+	ps := NewPatternSet(
+		MustParse("src/**/*_test.go"),
+		MustParse("src/d0/**/d1/*.go"),
+		MustParse("**/d1/d?/README"),
+	)
+
+	var got walkFuncCalls
+	if err := ps.Glob(got.walkFunc, traceLogOpt, WithFilesystem(fsys)); err != nil {
+		t.Fatalf("ps.Glob(...) = %v", err)
+	}
+
+	var want []walkFuncArgs
+	for name := range fsys {
+		if ps.Match(name) != nil {
+			want = append(want, walkFuncArgs{Path: name})
+		}
+	}
+	sort.Slice(want, func(i, j int) bool { return want[i].Path < want[j].Path })
+
+	if diff := cmp.Diff(got.calls, want); diff != "" {
+		t.Errorf("walked paths diff (-got +want):\n%s", diff)
+	}
+}
+
+func BenchmarkPatternSet_Match(b *testing.B) {
+	var patterns []*Pattern
+	for i := 0; i < 300; i++ {
+		patterns = append(patterns, MustParse(fmt.Sprintf("team%d/**/*.{go,md}", i)))
+	}
+	ps := NewPatternSet(patterns...)
+	path := "team150/services/api/handlers/user.go"
+	ps.Match(path)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		ps.MatchFirst(path)
+	}
+}
@@ -1,8 +1,11 @@
 package zzglob
 
 import (
+	"errors"
+	"os"
 	"os/user"
 	"path/filepath"
+	"slices"
 	"strings"
 )
 
@@ -11,10 +14,22 @@ import (
 // - prefix **/ becomes {,**/}
 // - /**/ becomes /{,**/}
 // Because ~ means homedir:
-// - Prefix ~/ becomes homedir/ (but only if user.Current() succeeds.)
-//
-// TODO: Arbitrary local user homedirs?
-func preprocess(in tokens, expandTilde bool) tokens {
+// - Prefix ~/ becomes homedir/, ~alice/ becomes alice's homedir/, ~+/ becomes
+// the working directory, and ~-/ becomes the previous working directory
+// (but only if the resolver succeeds, and the pattern itself starts with ~,
+// i.e. the ~ isn't escaped or from an environment variable.)
+func preprocess(in tokens, cfg *parseConfig, tildePrefix bool) tokens {
+	if cfg.expandTilde && tildePrefix {
+		resolve := cfg.homeDirResolver
+		if resolve == nil {
+			resolve = defaultHomeDirResolver
+		}
+		in = expandTildePrefix(in, resolve)
+	}
+
+	// /**{n,m}/ becomes /*/{n,m}, and prefix **{n,m}/ becomes */{n,m}
+	in = rewriteBoundedDoubleStars(in)
+
 	type replacement struct {
 		find, sub tokens
 	}
@@ -23,21 +38,11 @@ func preprocess(in tokens, expandTilde bool) tokens {
 			// Prefix **/ becomes {,**/}
 			find: tokens{tokenDoubleStar, '/'},
 			sub: tokens{
-				tokenOpenBrace, tokenComma, tokenDoubleStar, '/', tokenCloseBrace,
+				tokenOpenImplicitBrace, tokenComma, tokenDoubleStar, '/', tokenCloseBrace,
 			},
 		},
 	}
 
-	if expandTilde {
-		if hd := homeDir(); len(hd) > 0 {
-			prefixSubs = append(prefixSubs, replacement{
-				// Prefix ~/ becomes homedir/
-				find: tokens{'~', '/'},
-				sub:  hd,
-			})
-		}
-	}
-
 	for _, ps := range prefixSubs {
 		in = replacePrefix(in, ps.find, ps.sub)
 	}
@@ -47,7 +52,7 @@ func preprocess(in tokens, expandTilde bool) tokens {
 			// /**/ becomes /{,**/}
 			find: tokens{'/', tokenDoubleStar, '/'},
 			sub: tokens{
-				'/', tokenOpenBrace, tokenComma, tokenDoubleStar, '/', tokenCloseBrace,
+				'/', tokenOpenImplicitBrace, tokenComma, tokenDoubleStar, '/', tokenCloseBrace,
 			},
 		},
 	}
@@ -59,25 +64,131 @@ func preprocess(in tokens, expandTilde bool) tokens {
 	return in
 }
 
-// homeDir returns the current user's homedir as a literal token sequence.
-// It will always end in the `/` token.
-func homeDir() tokens {
-	u, err := user.Current()
-	if err != nil {
+// rewriteBoundedDoubleStars rewrites each **{n,m} that is a whole path
+// segment, followed by a separator, into a repetition of the segment */.
+// This way, when n = 0, the pattern can match zero segments without doubling
+// up the separators (similar to how /**/ becomes /{,**/}).
+func rewriteBoundedDoubleStars(in tokens) tokens {
+	for i := 0; i < len(in); i++ {
+		if in[i] != tokenDoubleStar || (i > 0 && in[i-1] != '/') {
+			continue
+		}
+		if i+1 >= len(in) || in[i+1] != tokenOpenRepeat {
+			continue
+		}
+		j := slices.Index(in[i+1:], tokenCloseRepeat)
+		if j < 0 {
+			continue
+		}
+		j += i + 1
+		if j+1 >= len(in) || in[j+1] != '/' {
+			continue
+		}
+		// ** {n,m} / becomes * / {n,m}
+		in[i] = tokenStar
+		copy(in[i+2:j+2], in[i+1:j+1])
+		in[i+1] = '/'
+		i = j + 1
+	}
+	return in
+}
+
+// matchBase applies the gitignore-style rule for MatchBase. If the pattern
+// had a leading separator (leadingSep), it is removed, anchoring the pattern
+// to the root of the walk. Otherwise, if the pattern contains no separators
+// (other than a trailing separator), it is prefixed with {,**/} so that it
+// can match at any depth.
+func matchBase(in tokens, leadingSep bool) tokens {
+	if leadingSep && len(in) > 0 && in[0] == '/' {
+		return in[1:]
+	}
+	if i := slices.Index(in, '/'); i >= 0 && i < len(in)-1 {
+		return in
+	}
+	return append(tokens{
+		tokenOpenImplicitBrace, tokenComma, tokenImplicitDoubleStar, '/', tokenCloseBrace,
+	}, in...)
+}
+
+// expandTildePrefix replaces a leading tilde-prefix (~ followed by literals
+// up to the first /) and the / with the directory returned by resolve. A ~
+// without a / after it (e.g. the whole pattern is ~) isn't a tilde-prefix. If
+// resolve fails, in is returned unchanged.
+func expandTildePrefix(in tokens, resolve func(string) (string, error)) tokens {
+	if len(in) == 0 || in[0] != '~' {
+		return in
+	}
+	end := -1
+	var name []rune
+	for i, t := range in[1:] {
+		if t < 0 {
+			// Not a literal, so not a tilde-prefix.
+			return in
+		}
+		if t == '/' {
+			end = i + 1
+			break
+		}
+		name = append(name, rune(t))
+	}
+	if end < 0 {
+		return in
+	}
+
+	hd := homeDir(string(name), resolve)
+	if len(hd) == 0 {
+		return in
+	}
+	return append(hd, in[end+1:]...)
+}
+
+// homeDir resolves the homedir for the tilde-prefix name as a literal token
+// sequence. It will always end in the `/` token.
+func homeDir(name string, resolve func(string) (string, error)) tokens {
+	dir, err := resolve(name)
+	if err != nil || dir == "" {
 		// Oh well, no homedir for you.
 		return nil
 	}
-	homeDir := filepath.ToSlash(u.HomeDir)
-	hd := make(tokens, 0, len(u.HomeDir))
-	for _, r := range homeDir {
+	dir = filepath.ToSlash(dir)
+	hd := make(tokens, 0, len(dir)+1)
+	for _, r := range dir {
 		hd = append(hd, token(r))
 	}
-	if !strings.HasSuffix(homeDir, "/") {
+	if !strings.HasSuffix(dir, "/") {
 		hd = append(hd, '/')
 	}
 	return hd
 }
 
+// defaultHomeDirResolver resolves tilde-prefixes unless overridden with
+// WithHomeDirResolver.
+func defaultHomeDirResolver(name string) (string, error) {
+	switch name {
+	case "":
+		u, err := user.Current()
+		if err != nil {
+			return "", err
+		}
+		return u.HomeDir, nil
+
+	case "+":
+		return os.Getwd()
+
+	case "-":
+		if dir := os.Getenv("OLDPWD"); dir != "" {
+			return dir, nil
+		}
+		return "", errors.New("OLDPWD not set")
+	}
+
+	u, err := user.Lookup(name)
+	if err != nil {
+		return "", err
+	}
+	return u.HomeDir, nil
+}
+
 // hasPrefix reports whether in has the prefix.
 func hasPrefix(in, prefix tokens) bool {
 	if len(in) < len(prefix) {
@@ -128,13 +239,17 @@ func replaceAll(in, toFind, sub tokens) tokens {
 // the final path separator. tks is trimmed to be the remainder of the pattern.
 func findRoot(tks *tokens) string {
 	var root []rune
-	lastSlash := -1
+	lastSlash, prevSlash := -1, -1
 	for i, t := range *tks {
+		if t == tokenOpenRepeat {
+			// The segment before the repetition is part of the repetition.
+			lastSlash = prevSlash
+		}
 		if t < 0 {
 			break
 		}
 		if t == '/' {
-			lastSlash = i
+			lastSlash, prevSlash = i, lastSlash
 		}
 		root = append(root, rune(t))
 	}
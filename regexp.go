@@ -0,0 +1,427 @@
+package zzglob
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+	"unicode"
+)
+
+// RegexpDialect is a regular expression syntax, for Pattern.RegexpString.
+type RegexpDialect int
+
+const (
+	// RE2 is the syntax of RE2 and Go's regexp package, which is also
+	// accepted by Rust's regex crate (and so ripgrep).
+	RE2 RegexpDialect = iota
+
+	// POSIXExtended is POSIX extended regular expression (ERE) syntax, as
+	// used by grep -E and many SQL REGEXP implementations. It has no escape
+	// sequences, so non-printable runes are written as they are.
+	POSIXExtended
+)
+
+// Regexp returns a regular expression (anchored at both ends) that matches
+// exactly the paths that the pattern matches.
+func (p *Pattern) Regexp() (*regexp.Regexp, error) {
+	return regexp.Compile(p.RegexpString(RE2))
+}
+
+// RegexpString returns a regular expression in the given dialect (anchored at
+// both ends) that matches exactly the paths that the pattern matches. It is
+// translated from the state machine, so it may be much longer than the
+// pattern.
+func (p *Pattern) RegexpString(dialect RegexpDialect) string {
+	var root []*rxNode
+	for _, r := range p.root {
+		rs := []rangeExp{{r, r}}
+		if p.inputConfig.caseInsensitive {
+			rs = foldRanges(rs)
+		}
+		root = append(root, rxClass(rs))
+	}
+	n := rxConcat(root...)
+	if p.initial != nil {
+		n = rxConcat(n, machineRegexp(p.initial))
+	}
+	if n == nil {
+		// Matches nothing.
+		return "^a^"
+	}
+	return "^" + n.render(dialect) + "$"
+}
+
+// machineRegexp converts the automaton into a regular expression by state
+// elimination. It returns nil if the automaton accepts nothing.
+func machineRegexp(initial *state) *rxNode {
+	// Number the states. 0 is a new start state, and 1 is a new final state.
+	ids := make(map[*state]int)
+	var order []*state
+	visit(initial, func(s *state) {
+		ids[s] = len(order) + 2
+		order = append(order, s)
+	})
+	n := len(order) + 2
+
+	type key struct{ from, to int }
+	edges := make(map[key]*rxNode)
+	add := func(from, to int, x *rxNode) {
+		edges[key{from, to}] = rxAlt(edges[key{from, to}], x)
+	}
+	add(0, ids[initial], rxConcat())
+	for _, s := range order {
+		if s.Accept {
+			add(ids[s], 1, rxConcat())
+		}
+		for _, e := range s.Out {
+			if e.Expr == nil {
+				add(ids[s], ids[e.State], rxConcat())
+				continue
+			}
+			add(ids[s], ids[e.State], rxClass(e.Expr.runeRanges()))
+		}
+	}
+
+	// Eliminate the states one at a time, cheapest first, replacing each
+	// path through the state with a direct edge.
+	removed := make([]bool, n)
+	for range order {
+		ins := make([][]int, n)
+		outs := make([][]int, n)
+		for k := range edges {
+			if k.from != k.to {
+				outs[k.from] = append(outs[k.from], k.to)
+				ins[k.to] = append(ins[k.to], k.from)
+			}
+		}
+		best := -1
+		for i := 2; i < n; i++ {
+			if removed[i] {
+				continue
+			}
+			if best < 0 || len(ins[i])*len(outs[i]) < len(ins[best])*len(outs[best]) {
+				best = i
+			}
+		}
+		removed[best] = true
+
+		loop := rxStar(edges[key{best, best}])
+		delete(edges, key{best, best})
+		slices.Sort(ins[best])
+		slices.Sort(outs[best])
+		for _, i := range ins[best] {
+			for _, j := range outs[best] {
+				add(i, j, rxConcat(edges[key{i, best}], loop, edges[key{best, j}]))
+			}
+		}
+		for _, i := range ins[best] {
+			delete(edges, key{i, best})
+		}
+		for _, j := range outs[best] {
+			delete(edges, key{best, j})
+		}
+	}
+	return edges[key{0, 1}]
+}
+
+// rxOp is the kind of rxNode.
+type rxOp int
+
+const (
+	rxOpClass  rxOp = iota // a single rune from ranges
+	rxOpConcat             // subs in sequence (no subs: the empty string)
+	rxOpAlt                // any of subs
+	rxOpStar               // zero or more of subs[0]
+)
+
+// rxNode is a node of a simplified regular expression syntax tree. A nil
+// *rxNode matches nothing.
+type rxNode struct {
+	op     rxOp
+	ranges []rangeExp
+	subs   []*rxNode
+}
+
+func rxClass(rs []rangeExp) *rxNode {
+	if len(rs) == 0 {
+		return nil
+	}
+	return &rxNode{op: rxOpClass, ranges: rs}
+}
+
+// rxConcat returns the concatenation of xs. If any is nil (matches nothing),
+// so does the concatenation.
+func rxConcat(xs ...*rxNode) *rxNode {
+	out := &rxNode{op: rxOpConcat}
+	for _, x := range xs {
+		switch {
+		case x == nil:
+			return nil
+		case x.op == rxOpConcat:
+			out.subs = append(out.subs, x.subs...)
+		default:
+			out.subs = append(out.subs, x)
+		}
+	}
+	if len(out.subs) == 1 {
+		return out.subs[0]
+	}
+	return out
+}
+
+// rxAlt returns the alternation of a and b, merging character classes and
+// removing duplicates.
+func rxAlt(a, b *rxNode) *rxNode {
+	switch {
+	case a == nil:
+		return b
+	case b == nil:
+		return a
+	}
+	var subs []*rxNode
+	for _, x := range []*rxNode{a, b} {
+		if x.op == rxOpAlt {
+			subs = append(subs, x.subs...)
+		} else {
+			subs = append(subs, x)
+		}
+	}
+
+	// Merge all the single-rune classes into one, and drop duplicates.
+	var ranges []rangeExp
+	out := &rxNode{op: rxOpAlt}
+	seen := make(map[string]bool)
+	for _, x := range subs {
+		if x.op == rxOpClass {
+			ranges = append(ranges, x.ranges...)
+			continue
+		}
+		if k := x.render(RE2); !seen[k] {
+			seen[k] = true
+			out.subs = append(out.subs, x)
+		}
+	}
+	if len(ranges) > 0 {
+		out.subs = append([]*rxNode{rxClass(mergeRanges(ranges))}, out.subs...)
+	}
+	if len(out.subs) == 1 {
+		return out.subs[0]
+	}
+	return out
+}
+
+// rxStar returns zero or more repetitions of x.
+func rxStar(x *rxNode) *rxNode {
+	if x == nil || x.isEmpty() {
+		return rxConcat()
+	}
+	if x.op == rxOpStar {
+		return x
+	}
+	if x.op == rxOpAlt {
+		// (|a)* is the same as a*
+		subs := slices.DeleteFunc(slices.Clone(x.subs), (*rxNode).isEmpty)
+		if len(subs) < len(x.subs) {
+			x = &rxNode{op: rxOpAlt, subs: subs}
+			if len(subs) == 1 {
+				x = subs[0]
+			}
+		}
+	}
+	return &rxNode{op: rxOpStar, subs: []*rxNode{x}}
+}
+
+// isEmpty reports whether x matches only the empty string.
+func (x *rxNode) isEmpty() bool {
+	return x.op == rxOpConcat && len(x.subs) == 0
+}
+
+// Precedence levels for rendering.
+const (
+	rxPrecAlt = iota
+	rxPrecConcat
+	rxPrecAtom
+)
+
+// render writes the expression in the dialect.
+func (x *rxNode) render(d RegexpDialect) string {
+	s, _ := x.renderPrec(d)
+	return s
+}
+
+func (x *rxNode) renderPrec(d RegexpDialect) (string, int) {
+	group := func(s string) string {
+		if d == POSIXExtended {
+			return "(" + s + ")"
+		}
+		return "(?:" + s + ")"
+	}
+	atom := func(y *rxNode) string {
+		s, prec := y.renderPrec(d)
+		if prec < rxPrecAtom {
+			return group(s)
+		}
+		return s
+	}
+
+	switch x.op {
+	case rxOpClass:
+		return renderClass(x.ranges, d)
+
+	case rxOpConcat:
+		var sb strings.Builder
+		for _, y := range x.subs {
+			s, prec := y.renderPrec(d)
+			if prec < rxPrecConcat {
+				s = group(s)
+			}
+			sb.WriteString(s)
+		}
+		return sb.String(), rxPrecConcat
+
+	case rxOpAlt:
+		var alts []string
+		optional := false
+		for _, y := range x.subs {
+			if y.isEmpty() {
+				optional = true
+				continue
+			}
+			s, _ := y.renderPrec(d)
+			alts = append(alts, s)
+		}
+		if !optional {
+			return strings.Join(alts, "|"), rxPrecAlt
+		}
+		if len(alts) == 1 && len(x.subs) == 2 {
+			for _, y := range x.subs {
+				if !y.isEmpty() {
+					return atom(y) + "?", rxPrecAtom
+				}
+			}
+		}
+		return group(strings.Join(alts, "|")) + "?", rxPrecAtom
+
+	case rxOpStar:
+		return atom(x.subs[0]) + "*", rxPrecAtom
+	}
+	panic(fmt.Sprintf("unknown rxOp %d", x.op))
+}
+
+// renderClass writes a character class matching one rune from rs.
+func renderClass(rs []rangeExp, d RegexpDialect) (string, int) {
+	switch {
+	case len(rs) == 1 && rs[0].lo == rs[0].hi:
+		return renderLiteral(rs[0].lo, d), rxPrecAtom
+	case slices.Equal(rs, allRanges):
+		if d == POSIXExtended {
+			// . doesn't always match newline.
+			return "(.|\n)", rxPrecAtom
+		}
+		return `(?s:.)`, rxPrecAtom
+	}
+
+	// A negated class is often shorter.
+	inv := invertRanges(rs)
+	negated := len(inv) < len(rs)
+	if negated {
+		rs = inv
+	}
+
+	var sb strings.Builder
+	sb.WriteByte('[')
+	if negated {
+		sb.WriteByte('^')
+	}
+	if d == POSIXExtended {
+		writePOSIXClass(&sb, rs)
+	} else {
+		for _, r := range rs {
+			sb.WriteString(classRune(r.lo))
+			if r.hi != r.lo {
+				if r.hi > r.lo+1 {
+					sb.WriteByte('-')
+				}
+				sb.WriteString(classRune(r.hi))
+			}
+		}
+	}
+	sb.WriteByte(']')
+	return sb.String(), rxPrecAtom
+}
+
+// writePOSIXClass writes the ranges for the inside of a POSIX bracket
+// expression. Backslash is not an escape character in POSIX brackets, so
+// the special characters have to be placed carefully: ] first, - last, and
+// ^ and [ not first. (\ is written twice, which is harmless in POSIX, and an
+// escaped \ in engines that do treat it as an escape.)
+func writePOSIXClass(sb *strings.Builder, rs []rangeExp) {
+	const specials = `]^\[-`
+	var found []rune
+	var plain []rangeExp
+	for _, r := range rs {
+		lo := r.lo
+		for x := r.lo; x <= r.hi && x < 0x80; x++ {
+			if strings.ContainsRune(specials, x) {
+				if x > lo {
+					plain = append(plain, rangeExp{lo, x - 1})
+				}
+				found = append(found, x)
+				lo = x + 1
+			}
+		}
+		if lo <= r.hi {
+			plain = append(plain, rangeExp{lo, r.hi})
+		}
+	}
+	if slices.Contains(found, ']') {
+		sb.WriteByte(']')
+	}
+	for _, r := range plain {
+		sb.WriteRune(r.lo)
+		if r.hi != r.lo {
+			if r.hi > r.lo+1 {
+				sb.WriteByte('-')
+			}
+			sb.WriteRune(r.hi)
+		}
+	}
+	for _, x := range []rune{'^', '\\', '['} {
+		if slices.Contains(found, x) {
+			if x == '\\' {
+				sb.WriteString(`\\`)
+			} else {
+				sb.WriteRune(x)
+			}
+		}
+	}
+	if slices.Contains(found, '-') {
+		sb.WriteByte('-')
+	}
+}
+
+// classRune writes a rune for use inside an RE2 character class.
+func classRune(r rune) string {
+	switch {
+	case strings.ContainsRune(`\-[]^`, r):
+		return `\` + string(r)
+	case r < 0x80 && unicode.IsPrint(r), r >= 0x80 && unicode.IsPrint(r) && r != unicode.ReplacementChar:
+		return string(r)
+	}
+	return fmt.Sprintf(`\x{%x}`, r)
+}
+
+// renderLiteral writes a single rune, escaped as needed.
+func renderLiteral(r rune, d RegexpDialect) string {
+	if d == POSIXExtended {
+		if strings.ContainsRune(`.[]()*+?{}|^$\`, r) {
+			return `\` + string(r)
+		}
+		return string(r)
+	}
+	if !unicode.IsPrint(r) || r == unicode.ReplacementChar {
+		return fmt.Sprintf(`\x{%x}`, r)
+	}
+	return regexp.QuoteMeta(string(r))
+}
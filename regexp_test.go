@@ -0,0 +1,119 @@
+package zzglob
+
+import (
+	"regexp"
+	"testing"
+	"unicode/utf8"
+)
+
+var regexpTests = []struct {
+	pattern string
+	opts    []ParseOption
+	paths   []string
+}{
+	{"a/b.go", nil, []string{"a/b.go", "a/b.gox", "a/bxgo", "A/B.GO"}},
+	{"*.go", nil, []string{"a.go", ".go", "a/b.go", "a.g", "a.go/"}},
+	{"src/**/*.go", nil, []string{"src/a.go", "src/x/y/a.go", "src/.go", "src/a.gox", "srca.go", "src/x/"}},
+	{"**", nil, []string{"", "a", "a/b/c", "/", "a\nb"}},
+	{"a/**/b", nil, []string{"a/b", "a/x/b", "a/x/y/b", "ab", "a//b", "a/xb"}},
+	{"a/**{1,2}/b", []ParseOption{AllowSegmentRepetition(true)}, []string{"a/b", "a/x/b", "a/x/y/b", "a/x/y/z/b"}},
+	{"[a-c]?[!x]", nil, []string{"abc", "dbc", "abx", "a/c", "ab/"}},
+	{"[^/]", nil, []string{"a", "/", "]"}},
+	{`[\]^\-[\\]`, nil, []string{"]", "^", "-", "[", `\`, "a"}},
+	{`[^\]^\-[\\]`, nil, []string{"]", "^", "-", "[", `\`, "a"}},
+	{"{foo,bar}/{,x}y", nil, []string{"foo/y", "bar/xy", "baz/y", "foo/x"}},
+	{`\*.\{md\}`, nil, []string{"*.{md}", "a.{md}"}},
+	{"a.(b)+c$|d", nil, []string{"a.(b)+c$|d", "a.bc"}},
+	{"frame<0-299>.png", []ParseOption{AllowNumericRange(true)}, []string{"frame7.png", "frame007.png", "frame300.png", "frame.png"}},
+	{"!(*.go)", []ParseOption{AllowExtGlob(true)}, []string{"a.go", "a.md", "", "a/b"}},
+	{"[[:digit:]]*[[:^alpha:]]", nil, []string{"1a2", "1aa", "x12", "12/"}},
+	{"file{1..12}.txt", []ParseOption{AllowBraceSequence(true)}, []string{"file1.txt", "file12.txt", "file13.txt", "file01.txt"}},
+	{"Src/*.GO", []ParseOption{CaseInsensitive(true)}, []string{"src/a.go", "SRC/A.Go", "src/a/b.go"}},
+	{`a\b/*`, []ParseOption{WithSwapSlashes(true)}, []string{`a/b/x`, `a\b\x`, "a/b/x/y"}},
+	{"x/*", []ParseOption{MatchBase(true)}, []string{"x/a", "d/x/a", "dx/a", "d/x/a/b"}},
+	{"中/?", nil, []string{"中/文", "中/", "中/ab"}},
+	{"[\x01-\x1f]", nil, []string{"\x01", "\n", " "}},
+}
+
+func TestPattern_Regexp(t *testing.T) {
+	for _, test := range regexpTests {
+		p, err := Parse(test.pattern, test.opts...)
+		if err != nil {
+			t.Fatalf("Parse(%q) = %v", test.pattern, err)
+		}
+		re, err := p.Regexp()
+		if err != nil {
+			t.Fatalf("Parse(%q).Regexp() = %v", test.pattern, err)
+		}
+		posix, err := regexp.CompilePOSIX(p.RegexpString(POSIXExtended))
+		if err != nil {
+			t.Fatalf("regexp.CompilePOSIX(%q) = %v", p.RegexpString(POSIXExtended), err)
+		}
+		for _, path := range test.paths {
+			want := p.Match(path)
+			if got := re.MatchString(path); got != want {
+				t.Errorf("Parse(%q).Regexp() = %v; MatchString(%q) = %t, want %t", test.pattern, re, path, got, want)
+			}
+			if got := posix.MatchString(path); got != want {
+				t.Errorf("Parse(%q).RegexpString(POSIXExtended) = %q; MatchString(%q) = %t, want %t", test.pattern, posix, path, got, want)
+			}
+		}
+	}
+}
+
+func TestPattern_RegexpString(t *testing.T) {
+	tests := []struct {
+		pattern, re2, posix string
+	}{
+		{"a/b.go", `^a/b\.go$`, `^a/b\.go$`},
+		{"*.go", `^[^/]*\.go$`, `^[^/]*\.go$`},
+		{"src/*.{c,h}", `^src/[^/]*\.[ch]$`, `^src/[^/]*\.[ch]$`},
+	}
+
+	for _, test := range tests {
+		p := MustParse(test.pattern)
+		if got := p.RegexpString(RE2); got != test.re2 {
+			t.Errorf("Parse(%q).RegexpString(RE2) = %q, want %q", test.pattern, got, test.re2)
+		}
+		if got := p.RegexpString(POSIXExtended); got != test.posix {
+			t.Errorf("Parse(%q).RegexpString(POSIXExtended) = %q, want %q", test.pattern, got, test.posix)
+		}
+	}
+}
+
+func TestPattern_Regexp_MatchesNothing(t *testing.T) {
+	re, err := Or().Regexp()
+	if err != nil {
+		t.Fatalf("Or().Regexp() = %v", err)
+	}
+	for _, path := range []string{"", "a", "^a^"} {
+		if re.MatchString(path) {
+			t.Errorf("Or().Regexp() = %v; MatchString(%q) = true, want false", re, path)
+		}
+	}
+}
+
+func FuzzRegexp(f *testing.F) {
+	for _, test := range regexpTests {
+		for _, path := range test.paths {
+			f.Add(test.pattern, path)
+		}
+	}
+	f.Fuzz(func(t *testing.T, pattern, path string) {
+		if !utf8.ValidString(pattern) || !utf8.ValidString(path) {
+			return
+		}
+		p, err := Parse(pattern)
+		if err != nil {
+			return
+		}
+		re, err := p.Regexp()
+		if err != nil {
+			// e.g. too large for RE2
+			return
+		}
+		if got, want := re.MatchString(path), p.Match(path); got != want {
+			t.Errorf("Parse(%q).Regexp() = %v; MatchString(%q) = %t, but Match = %t", pattern, re, path, got, want)
+		}
+	})
+}
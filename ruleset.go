@@ -0,0 +1,122 @@
+package zzglob
+
+import (
+	"errors"
+	"io/fs"
+)
+
+// Rule is a pattern that either includes or excludes the paths it matches.
+type Rule struct {
+	Pattern *Pattern
+	Exclude bool
+}
+
+// Include returns a rule that includes paths matching the pattern.
+func Include(p *Pattern) Rule { return Rule{Pattern: p} }
+
+// Exclude returns a rule that excludes paths matching the pattern.
+func Exclude(p *Pattern) Rule { return Rule{Pattern: p, Exclude: true} }
+
+// RuleSet is an ordered list of include and exclude rules, where the last rule
+// that matches a path decides whether it is included. For example, with the
+// rules
+//
+//	Include(src/**)
+//	Exclude(src/**/testdata/**)
+//	Include(src/**/testdata/golden/*)
+//
+// src/a/testdata/x is excluded, but src/a/testdata/golden/x is included.
+// Paths that match no rule are excluded. A RuleSet is safe for concurrent use.
+type RuleSet struct {
+	rules []Rule
+	set   *PatternSet
+}
+
+// NewRuleSet returns a RuleSet with the rules, in order.
+func NewRuleSet(rules ...Rule) *RuleSet {
+	patterns := make([]*Pattern, len(rules))
+	for i, r := range rules {
+		patterns[i] = r.Pattern
+	}
+	return &RuleSet{
+		rules: append([]Rule(nil), rules...),
+		set:   NewPatternSet(patterns...),
+	}
+}
+
+// Len returns the number of rules in the set.
+func (rs *RuleSet) Len() int { return len(rs.rules) }
+
+// Rule returns the rule with index i.
+func (rs *RuleSet) Rule(i int) Rule { return rs.rules[i] }
+
+// Match reports whether the path is included, and the index of the rule that
+// decided (the last rule that matches the path). If no rule matches, the path
+// is not included, and rule is -1. As with [Pattern.Match], directories
+// should be given a trailing slash.
+func (rs *RuleSet) Match(path string) (included bool, rule int) {
+	rule = rs.set.MatchLast(path)
+	return rule >= 0 && !rs.rules[rule].Exclude, rule
+}
+
+// Glob globs for files that are included by the rules. A directory is only
+// walked if some include rule could match something within it, and no later
+// exclude rule matches everything within it (e.g. because it ends in /**).
+func (rs *RuleSet) Glob(f fs.WalkDirFunc, opts ...GlobOption) error {
+	if f == nil {
+		return errors.New("nil WalkDirFunc in arg to RuleSet.Glob")
+	}
+
+	cfg := &globConfig{
+		translateSlashes: true,
+		traverseSymlinks: true,
+		callback:         f,
+	}
+	for _, o := range opts {
+		if o == nil {
+			continue
+		}
+		o(cfg)
+	}
+
+	return rs.set.glob(cfg, rs.decide)
+}
+
+// decide reports whether the states (reached by matching a path) include the
+// path, and whether anything within the path could be included.
+func (rs *RuleSet) decide(states stateSet) (accept, descend bool) {
+	last := -1          // last rule matching the path
+	lastLive := -1      // last include rule that could match within
+	lastUniversal := -1 // last exclude rule that matches everything within
+	for s := range states {
+		if s.Accept {
+			for _, i := range rs.set.accepts[s] {
+				last = max(last, i)
+				if rs.rules[i].Exclude && matchesAnything(s) {
+					lastUniversal = max(lastUniversal, i)
+				}
+			}
+		}
+		if len(s.Out) == 0 {
+			continue
+		}
+		for _, i := range rs.set.owners[s] {
+			if !rs.rules[i].Exclude {
+				lastLive = max(lastLive, i)
+			}
+		}
+	}
+	accept = last >= 0 && !rs.rules[last].Exclude
+	return accept, lastLive > lastUniversal
+}
+
+// matchesAnything reports whether s (an accepting state) accepts every
+// continuation, because it has a ** loop.
+func matchesAnything(s *state) bool {
+	for _, e := range s.Out {
+		if _, ok := e.Expr.(doubleStarExp); ok && e.State == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,160 @@
+package zzglob
+
+import (
+	"sort"
+	"testing"
+	"testing/fstest"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func testRuleSet() *RuleSet {
+	return NewRuleSet(
+		Include(MustParse("src/**")),
+		Exclude(MustParse("src/**/testdata/**")),
+		Include(MustParse("src/*/testdata/golden/*")),
+		Exclude(MustParse("**/*.tmp")),
+	)
+}
+
+func TestRuleSet_Match(t *testing.T) {
+	rs := testRuleSet()
+
+	tests := []struct {
+		path     string
+		included bool
+		rule     int
+	}{
+		{"src/a.go", true, 0},
+		{"src/a/b/c.go", true, 0},
+		{"src/a/testdata/x.txt", false, 1},
+		{"src/testdata/x.txt", false, 1},
+		{"src/a/testdata/golden/x.txt", true, 2},
+		{"src/a/testdata/golden/x.tmp", false, 3},
+		{"src/a/testdata/golden/deeper/x.txt", false, 1},
+		{"src/a/b/testdata/golden/x.txt", false, 1},
+		{"src/a.tmp", false, 3},
+		{"docs/a.md", false, -1},
+		{"a.tmp", false, 3},
+	}
+
+	for _, test := range tests {
+		included, rule := rs.Match(test.path)
+		if included != test.included || rule != test.rule {
+			t.Errorf("rs.Match(%q) = (%t, %d), want (%t, %d)", test.path, included, rule, test.included, test.rule)
+		}
+	}
+}
+
+func TestRuleSet_Glob(t *testing.T) {
+	fsys := &readDirRecorder{
+		FS: fstest.MapFS{
+			"src/a.go":                        {},
+			"src/a.tmp":                       {},
+			"src/lib/b.go":                    {},
+			"src/lib/testdata/in.txt":         {},
+			"src/lib/testdata/big/huge.bin":   {},
+			"src/lib/testdata/golden/out.txt": {},
+			"src/lib/testdata/golden/x.tmp":   {},
+			"src/lib/testdata/golden/d/y.txt": {},
+			"docs/index.md":                   {},
+		},
+	}
+
+	var got walkFuncCalls
+	if err := testRuleSet().Glob(got.walkFunc, traceLogOpt, WithFilesystem(fsys)); err != nil {
+		t.Fatalf("rs.Glob(...) = %v", err)
+	}
+
+	// Directories are matched too (src/** matches src/, and the * in
+	// golden/* can be empty).
+	want := []walkFuncArgs{
+		{Path: "src"},
+		{Path: "src/a.go"},
+		{Path: "src/lib"},
+		{Path: "src/lib/b.go"},
+		{Path: "src/lib/testdata/golden"},
+		{Path: "src/lib/testdata/golden/out.txt"},
+	}
+	if diff := cmp.Diff(got.calls, want); diff != "" {
+		t.Errorf("walked paths diff (-got +want):\n%s", diff)
+	}
+
+	// testdata has to be walked in case of golden, but testdata/big and
+	// golden/d don't, because no later rule could include anything in them.
+	wantReads := []string{".", "src", "src/lib", "src/lib/testdata", "src/lib/testdata/golden"}
+	if diff := cmp.Diff(fsys.reads, wantReads); diff != "" {
+		t.Errorf("read directories diff (-got +want):\n%s", diff)
+	}
+}
+
+func TestRuleSet_GlobPrunesExcluded(t *testing.T) {
+	fsys := &readDirRecorder{
+		FS: fstest.MapFS{
+			"a/x.go":                  {},
+			"node_modules/b/y.go":     {},
+			"node_modules/b/c/z.go":   {},
+			"vendor/keep/w.go":        {},
+			"vendor/other/v.go":       {},
+			"vendor/keep/deeper/u.go": {},
+		},
+	}
+
+	rs := NewRuleSet(
+		Include(MustParse("**/*.go")),
+		Exclude(MustParse("node_modules/**")),
+		Exclude(MustParse("vendor/**")),
+		Include(MustParse("vendor/keep/*.go")),
+	)
+
+	var got walkFuncCalls
+	if err := rs.Glob(got.walkFunc, traceLogOpt, WithFilesystem(fsys)); err != nil {
+		t.Fatalf("rs.Glob(...) = %v", err)
+	}
+	got.sortCalls()
+
+	want := []walkFuncArgs{
+		{Path: "a/x.go"},
+		{Path: "vendor/keep/w.go"},
+	}
+	if diff := cmp.Diff(got.calls, want); diff != "" {
+		t.Errorf("walked paths diff (-got +want):\n%s", diff)
+	}
+
+	wantReads := []string{".", "a", "vendor", "vendor/keep"}
+	if diff := cmp.Diff(fsys.reads, wantReads); diff != "" {
+		t.Errorf("read directories diff (-got +want):\n%s", diff)
+	}
+}
+
+func TestRuleSet_GlobAgreesWithMatch(t *testing.T) {
+	fsys := deepMapFS(4, 2)
+	rs := NewRuleSet(
+		Include(MustParse("src/**/*.go")),
+		Exclude(MustParse("src/d0/**")),
+		Include(MustParse("src/d0/**/d1/a.go")),
+		Exclude(MustParse("**/*_test.go")),
+		Include(MustParse("src/d1/d?/*_test.go")),
+	)
+
+	var got walkFuncCalls
+	if err := rs.Glob(got.walkFunc, traceLogOpt, WithFilesystem(fsys)); err != nil {
+		t.Fatalf("rs.Glob(...) = %v", err)
+	}
+	got.sortCalls()
+
+	var want []walkFuncArgs
+	for name := range fsys {
+		if included, _ := rs.Match(name); included {
+			want = append(want, walkFuncArgs{Path: name})
+		}
+	}
+	sort.Slice(want, func(i, j int) bool { return want[i].Path < want[j].Path })
+
+	if len(want) == 0 {
+		t.Fatal("rules include nothing in the test filesystem")
+	}
+	if diff := cmp.Diff(got.calls, want); diff != "" {
+		t.Errorf("walked paths diff (-got +want):\n%s", diff)
+	}
+}
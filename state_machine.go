@@ -1,5 +1,11 @@
 package zzglob
 
+import (
+	"slices"
+	"strconv"
+	"strings"
+)
+
 // state represents a possible state of a state machine.
 type state struct {
 	// Out contains all possible transitions out of this state.
@@ -22,6 +28,11 @@ type edge struct {
 	// State is the machine state that the machine transitions into when Expr
 	// is satisfied.
 	State *state
+
+	// Tag, if non-zero (and Expr is nil), records the current position in
+	// capture slot Tag-1 when the edge is followed. Capture group k uses
+	// slots 2k (start) and 2k+1 (end).
+	Tag int
 }
 
 // singleton wraps a single value in a set.
@@ -91,3 +102,319 @@ func transitiveClosure(states stateSet) {
 		}
 	}
 }
+
+// determinise performs the subset construction on the automaton starting at
+// initial, considering only runes within universe (sorted, non-overlapping
+// ranges). It returns the initial state of a new automaton that matches the
+// same inputs (restricted to the universe), but has no nil edges, and has
+// at most one edge matching any given rune out of each state. A state of the
+// new automaton is accepting if any state in its subset is accepting.
+//
+// If total is true, then every rune in the universe has an edge out of every
+// state, which may lead to a "dead" (non-accepting, inescapable) state.
+// Flipping Accept on every state of a total automaton produces the
+// complement (within the universe).
+func determinise(initial *state, universe []rangeExp, total bool) *state {
+	// Give each input state a number, to produce keys for subsets.
+	ids := make(map[*state]int)
+	keyOf := func(ss stateSet) string {
+		ns := make([]int, 0, len(ss))
+		for s := range ss {
+			id, ok := ids[s]
+			if !ok {
+				id = len(ids)
+				ids[s] = id
+			}
+			ns = append(ns, id)
+		}
+		slices.Sort(ns)
+		var sb strings.Builder
+		for _, n := range ns {
+			sb.WriteString(strconv.Itoa(n))
+			sb.WriteByte(',')
+		}
+		return sb.String()
+	}
+
+	// The rune ranges of each edge are needed repeatedly.
+	edgeRanges := make(map[*state][][]rangeExp)
+	rangesOf := func(s *state) [][]rangeExp {
+		if rs, ok := edgeRanges[s]; ok {
+			return rs
+		}
+		rs := make([][]rangeExp, len(s.Out))
+		for i, e := range s.Out {
+			if e.Expr != nil {
+				rs[i] = e.Expr.runeRanges()
+			}
+		}
+		edgeRanges[s] = rs
+		return rs
+	}
+
+	var dead *state
+	deadState := func() *state {
+		if dead == nil {
+			dead = &state{}
+			for _, r := range universe {
+				dead.Out = append(dead.Out, edge{Expr: r.exp(), State: dead})
+			}
+		}
+		return dead
+	}
+
+	type subset struct {
+		states stateSet
+		dfa    *state
+	}
+	start := singleton(initial)
+	transitiveClosure(start)
+	subsets := map[string]*subset{
+		keyOf(start): {states: start, dfa: &state{}},
+	}
+	q := []*subset{subsets[keyOf(start)]}
+
+	for len(q) > 0 {
+		cur := q[0]
+		q = q[1:]
+
+		// Find the boundaries between runes where the set of matching edges
+		// could change.
+		bounds := make([]rune, 0, 2*len(universe))
+		for _, r := range universe {
+			bounds = append(bounds, r.lo, r.hi+1)
+		}
+		for s := range cur.states {
+			if s.Accept {
+				cur.dfa.Accept = true
+			}
+			for _, rs := range rangesOf(s) {
+				for _, r := range rs {
+					bounds = append(bounds, r.lo, r.hi+1)
+				}
+			}
+		}
+		slices.Sort(bounds)
+		bounds = slices.Compact(bounds)
+
+		// Each interval between two consecutive boundaries either entirely
+		// matches an edge, or entirely doesn't match it. So a representative
+		// rune from the interval can be used to find the next subset.
+		// last is the index of the edge for the previous interval, and
+		// lastLo is the start of its range.
+		last, lastLo := -1, rune(0)
+		for i := 0; i+1 < len(bounds); i++ {
+			lo, hi := bounds[i], bounds[i+1]-1
+			if !inRanges(universe, lo) {
+				last = -1
+				continue
+			}
+			next := make(stateSet)
+			for s := range cur.states {
+				for _, e := range s.Out {
+					if e.Expr != nil && e.Expr.match(lo) {
+						next[e.State] = struct{}{}
+					}
+				}
+			}
+
+			var target *state
+			if len(next) == 0 {
+				if !total {
+					last = -1
+					continue
+				}
+				target = deadState()
+			} else {
+				transitiveClosure(next)
+				key := keyOf(next)
+				ss := subsets[key]
+				if ss == nil {
+					ss = &subset{states: next, dfa: &state{}}
+					subsets[key] = ss
+					q = append(q, ss)
+				}
+				target = ss.dfa
+			}
+
+			// Extend the previous edge if it goes to the same place.
+			if last >= 0 && cur.dfa.Out[last].State == target {
+				cur.dfa.Out[last].Expr = rangeExp{lastLo, hi}.exp()
+				continue
+			}
+			cur.dfa.Out = append(cur.dfa.Out, edge{
+				Expr:  rangeExp{lo, hi}.exp(),
+				State: target,
+			})
+			last, lastLo = len(cur.dfa.Out)-1, lo
+		}
+	}
+
+	return subsets[keyOf(start)].dfa
+}
+
+// visit calls f once for each state reachable from initial (including
+// initial), in breadth-first order. f is called after the out-edges of the
+// state have been followed, so any edges added by f are not visited.
+func visit(initial *state, f func(*state)) {
+	seen := map[*state]bool{initial: true}
+	q := []*state{initial}
+	for len(q) > 0 {
+		s := q[0]
+		q = q[1:]
+		for _, e := range s.Out {
+			if !seen[e.State] {
+				seen[e.State] = true
+				q = append(q, e.State)
+			}
+		}
+		f(s)
+	}
+}
+
+// foldCase rewrites the expressions on the edges of the automaton so that
+// they match case-insensitively (using Unicode simple case folding).
+func foldCase(initial *state) {
+	visit(initial, func(s *state) {
+		out := make([]edge, 0, len(s.Out))
+		for _, e := range s.Out {
+			switch x := e.Expr.(type) {
+			case literalExp, rangeExp:
+				// Equivalent to a char class, which is a bunch of edges.
+				for _, r := range foldRanges(x.runeRanges()) {
+					out = append(out, edge{Expr: r.exp(), State: e.State})
+				}
+				continue
+
+			case negatedLiteralExp:
+				rs := foldRanges([]rangeExp{{rune(x), rune(x)}})
+				if len(rs) > 1 || rs[0].lo != rs[0].hi {
+					e.Expr = negatedCCExp{ranges: rs}
+				}
+
+			case negatedCCExp:
+				classes := make([]namedClassExp, 0, len(x.classes))
+				for _, c := range x.classes {
+					c.fold = true
+					classes = append(classes, c)
+				}
+				e.Expr = negatedCCExp{
+					ranges:  foldRanges(x.ranges),
+					classes: classes,
+				}
+
+			case namedClassExp:
+				x.fold = true
+				e.Expr = x
+			}
+			out = append(out, e)
+		}
+		s.Out = out
+	})
+}
+
+// hideDotfiles returns a copy of the automaton where only literal . can match
+// a . at the start of a path segment. Since whether or not a state is at the
+// start of a segment depends on the path taken to reach it, each state is
+// copied up to twice (once for each possibility).
+func hideDotfiles(initial *state) *state {
+	type key struct {
+		s     *state
+		start bool
+	}
+	copies := make(map[key]*state)
+	var q []key
+	get := func(k key) *state {
+		if c := copies[k]; c != nil {
+			return c
+		}
+		c := &state{Accept: k.s.Accept}
+		copies[k] = c
+		q = append(q, k)
+		return c
+	}
+
+	// The pattern root is either empty or ends with /, so the initial state is
+	// always at the start of a segment.
+	newInitial := get(key{initial, true})
+	for len(q) > 0 {
+		k := q[0]
+		q = q[1:]
+		c := copies[k]
+
+		for _, e := range k.s.Out {
+			if e.Expr == nil {
+				c.Out = append(c.Out, edge{State: get(key{e.State, k.start}), Tag: e.Tag})
+				continue
+			}
+			if x, ok := e.Expr.(literalExp); ok {
+				c.Out = append(c.Out, edge{Expr: x, State: get(key{e.State, x == '/'})})
+				continue
+			}
+
+			// Split off / (which starts the next segment) from the rest.
+			if e.Expr.match('/') {
+				c.Out = append(c.Out, edge{Expr: literalExp('/'), State: get(key{e.State, true})})
+			}
+			except := []rune{'/'}
+			if k.start {
+				except = append(except, '.')
+			}
+			for _, x := range exceptRunes(e.Expr, except) {
+				c.Out = append(c.Out, edge{Expr: x, State: get(key{e.State, false})})
+			}
+		}
+	}
+	return newInitial
+}
+
+// exceptRunes returns expressions that between them match the runes matched
+// by e, except for those in except.
+func exceptRunes(e expression, except []rune) []expression {
+	if !slices.ContainsFunc(except, e.match) {
+		return []expression{e}
+	}
+
+	ex := make([]rangeExp, 0, len(except))
+	for _, r := range except {
+		ex = append(ex, rangeExp{r, r})
+	}
+
+	switch x := e.(type) {
+	case doubleStarExp:
+		if len(except) == 1 && except[0] == '/' {
+			return []expression{starExp{}}
+		}
+		return []expression{negatedCCExp{ranges: mergeRanges(ex)}}
+
+	case starExp, questionExp:
+		return []expression{negatedCCExp{ranges: mergeRanges(append(ex, rangeExp{'/', '/'}))}}
+
+	case negatedLiteralExp:
+		return []expression{negatedCCExp{ranges: mergeRanges(append(ex, rangeExp{rune(x), rune(x)}))}}
+
+	case negatedCCExp:
+		return []expression{negatedCCExp{
+			ranges:  mergeRanges(append(ex, x.ranges...)),
+			classes: x.classes,
+		}}
+
+	case namedClassExp:
+		if x.negated {
+			// [\P{L}] minus some runes is the same as [^\p{L}...].
+			x.negated = false
+			x.name = `\p` + strings.TrimPrefix(x.name, `\P`)
+			return []expression{negatedCCExp{
+				ranges:  mergeRanges(ex),
+				classes: []namedClassExp{x},
+			}}
+		}
+	}
+
+	// Equivalent to a char class, which is a bunch of edges.
+	var out []expression
+	for _, r := range invertRanges(mergeRanges(append(invertRanges(e.runeRanges()), ex...))) {
+		out = append(out, r.exp())
+	}
+	return out
+}
@@ -1,7 +1,10 @@
 package zzglob
 
 import (
+	"os"
+	"regexp"
 	"strings"
+	"unicode/utf8"
 )
 
 // Lexer tokens
@@ -20,10 +23,72 @@ const (
 	tokenOpenBracket  token = -'[' // [
 	tokenCloseBracket token = -']' // ]
 	tokenComma        token = -',' // ,
+	tokenDash         token = -'-' // - (only within char classes and numeric ranges)
 	tokenDoubleStar   token = -128 // **
 	tokenBracketCaret token = -129 // [^
+
+	// Named classes (only within char classes). The name follows as literals.
+	tokenOpenPOSIXClass      token = -130 // [:
+	tokenClosePOSIXClass     token = -131 // :]
+	tokenOpenUnicodeClass    token = -132 // \p{
+	tokenOpenNegUnicodeClass token = -133 // \P{
+	tokenCloseUnicodeClass   token = -134 // }
+
+	// Extended glob operators. The alternatives are separated by | and
+	// closed by ).
+	tokenExtQuestion token = -135 // ?(
+	tokenExtStar     token = -136 // *(
+	tokenExtPlus     token = -137 // +(
+	tokenExtAt       token = -138 // @(
+	tokenExtBang     token = -139 // !(
+	tokenPipe        token = -'|' // | (only within extended glob operators)
+	tokenCloseParen  token = -')' // ) (only within extended glob operators)
+
+	tokenDotDot token = -140 // .. (only within brace sequences)
+
+	// Numeric ranges. The bounds (if any) follow as literals, separated by
+	// tokenDash.
+	tokenOpenNumericRange  token = -141 // <
+	tokenCloseNumericRange token = -142 // >
+
+	// Segment repetitions, following / or **. The bounds follow as literals,
+	// separated by tokenComma (if there are two).
+	tokenOpenRepeat  token = -143 // {
+	tokenCloseRepeat token = -144 // }
+
+	// An alternation added by preprocessing (e.g. the { in /{,**/}), which
+	// is not a capture group. It is closed by tokenCloseBrace.
+	tokenOpenImplicitBrace token = -145 // {
+
+	// A ** added by preprocessing (e.g. for MatchBase), which is not a
+	// capture group.
+	tokenImplicitDoubleStar token = -146 // **
 )
 
+// braceSequenceRE matches a brace sequence, e.g. {1..10}, {01..20..2}, or
+// {a..f}. (Mismatched ends like {1..f} are reported by the parser.)
+var braceSequenceRE = regexp.MustCompile(`^\{(-?[0-9]+|[a-zA-Z])\.\.(-?[0-9]+|[a-zA-Z])(?:\.\.(-?[0-9]+))?\}`)
+
+// numericRangeRE matches a zsh-style numeric range, e.g. <1-100>, <5->, <->.
+var numericRangeRE = regexp.MustCompile(`^<([0-9]*)-([0-9]*)>`)
+
+// repeatRE matches the bounds of a segment repetition, e.g. {2}, {1,3},
+// {,3}, or {1,}.
+var repeatRE = regexp.MustCompile(`^\{([0-9]*)(,?)([0-9]*)\}`)
+
+// envVarRE matches an environment variable reference, e.g. $HOME, ${GOPATH},
+// or ${XDG_CACHE_HOME:-/var/cache}.
+var envVarRE = regexp.MustCompile(`^\$(?:([A-Za-z_][A-Za-z0-9_]*)|\{([A-Za-z_][A-Za-z0-9_]*)(:-[^}]*)?\})`)
+
+// extGlobTokens maps the first rune of each extended glob operator to its token.
+var extGlobTokens = map[rune]token{
+	'?': tokenExtQuestion,
+	'*': tokenExtStar,
+	'+': tokenExtPlus,
+	'@': tokenExtAt,
+	'!': tokenExtBang,
+}
+
 func (t token) String() string {
 	switch t {
 	case tokenStar:
@@ -40,10 +105,50 @@ func (t token) String() string {
 		return "]"
 	case tokenComma:
 		return ","
+	case tokenDash:
+		return "-"
 	case tokenDoubleStar:
 		return "**"
 	case tokenBracketCaret:
 		return "[^"
+	case tokenOpenPOSIXClass:
+		return "[:"
+	case tokenClosePOSIXClass:
+		return ":]"
+	case tokenOpenUnicodeClass:
+		return `\p{`
+	case tokenOpenNegUnicodeClass:
+		return `\P{`
+	case tokenCloseUnicodeClass:
+		return "}"
+	case tokenExtQuestion:
+		return "?("
+	case tokenExtStar:
+		return "*("
+	case tokenExtPlus:
+		return "+("
+	case tokenExtAt:
+		return "@("
+	case tokenExtBang:
+		return "!("
+	case tokenPipe:
+		return "|"
+	case tokenCloseParen:
+		return ")"
+	case tokenDotDot:
+		return ".."
+	case tokenOpenNumericRange:
+		return "<"
+	case tokenCloseNumericRange:
+		return ">"
+	case tokenOpenRepeat:
+		return "{"
+	case tokenCloseRepeat:
+		return "}"
+	case tokenOpenImplicitBrace:
+		return "{"
+	case tokenImplicitDoubleStar:
+		return "**"
 	}
 	return string(rune(t))
 }
@@ -63,9 +168,15 @@ func tokenise(p string, cfg *parseConfig) *tokens {
 	// interpretation of the next rune, e.g. \ or *. Otherwise it is 0.
 	var prev rune
 	insideCC := false // within a char class
+	skipTo := 0       // skip runes before this byte offset (already tokenised)
+	extDepth := 0     // nesting depth of extended glob operators
 
 	// Walk through string, producing tokens.
-	for _, c := range p {
+	for i, c := range p {
+		if i < skipTo {
+			continue
+		}
+
 		// Escaping something?
 		if prev == escapeChar {
 			// The escapeChar escaped c, so c is a literal.
@@ -110,11 +221,40 @@ func tokenise(p string, cfg *parseConfig) *tokens {
 		if insideCC {
 			switch c {
 			case escapeChar:
-				if cfg.allowEscaping { // Start of escape
-					prev = escapeChar
-				} else {
+				if !cfg.allowEscaping {
 					tks = append(tks, token(escapeChar))
+					break
+				}
+				if cfg.allowNamedCharClass {
+					// Unicode class, e.g. \p{Han} or \P{Han}?
+					rest := p[i+utf8.RuneLen(c):]
+					if name, negated, n := unicodeClassName(rest); n > 0 {
+						if negated {
+							tks = append(tks, tokenOpenNegUnicodeClass)
+						} else {
+							tks = append(tks, tokenOpenUnicodeClass)
+						}
+						tks = appendLiterals(tks, name)
+						tks = append(tks, tokenCloseUnicodeClass)
+						skipTo = i + utf8.RuneLen(c) + n
+						break
+					}
 				}
+				// Start of escape
+				prev = escapeChar
+
+			case '[':
+				// POSIX class, e.g. [:alpha:]?
+				if cfg.allowNamedCharClass {
+					if name, n := posixClassName(p[i:]); n > 0 {
+						tks = append(tks, tokenOpenPOSIXClass)
+						tks = appendLiterals(tks, name)
+						tks = append(tks, tokenClosePOSIXClass)
+						skipTo = i + n
+						break
+					}
+				}
+				tks = append(tks, token('['))
 
 			case ']':
 				// End of cc
@@ -126,6 +266,11 @@ func tokenise(p string, cfg *parseConfig) *tokens {
 				// That's handled by prev switch
 				tks = append(tks, token('^'))
 
+			case '-':
+				// Could be a range, or a literal - at either end of the class.
+				// The parser decides which.
+				tks = append(tks, tokenDash)
+
 			default:
 				tks = append(tks, token(c))
 			}
@@ -133,7 +278,34 @@ func tokenise(p string, cfg *parseConfig) *tokens {
 			continue
 		}
 
+		// Start of an extended glob operator, e.g. !( ?
+		if t, ok := extGlobTokens[c]; ok && cfg.allowExtGlob && strings.HasPrefix(p[i+1:], "(") {
+			tks = append(tks, t)
+			extDepth++
+			skipTo = i + 2
+			continue
+		}
+
 		switch c {
+		case '$':
+			if cfg.expandEnv {
+				// Environment variable?
+				if m := envVarRE.FindStringSubmatch(p[i:]); m != nil {
+					skipTo = i + len(m[0])
+					value := expandEnvVar(m, cfg)
+					// Always represent the path separator with / (see below).
+					value = strings.ReplaceAll(value, string(pathSep), "/")
+					if strings.HasPrefix(p[skipTo:], string(pathSep)) {
+						// Avoid doubling up the separator, e.g. for
+						// $HOME/foo where HOME=/home/me/
+						value = strings.TrimRight(value, "/")
+					}
+					tks = appendLiterals(tks, value)
+					break
+				}
+			}
+			tks = append(tks, token('$'))
+
 		case '*': // note prev != '*'
 			// It could be a * or ** depending on options.
 			switch {
@@ -182,7 +354,67 @@ func tokenise(p string, cfg *parseConfig) *tokens {
 			// We only get here if insideCC is false...
 			tks = append(tks, token(']'))
 
+		case '<':
+			if cfg.allowNumericRange {
+				if m := numericRangeRE.FindStringSubmatch(p[i:]); m != nil {
+					tks = append(tks, tokenOpenNumericRange)
+					tks = appendLiterals(tks, m[1])
+					tks = append(tks, tokenDash)
+					tks = appendLiterals(tks, m[2])
+					tks = append(tks, tokenCloseNumericRange)
+					skipTo = i + len(m[0])
+					break
+				}
+			}
+			tks = append(tks, token('<'))
+
+		case '|':
+			if extDepth > 0 {
+				tks = append(tks, tokenPipe)
+			} else {
+				tks = append(tks, token('|'))
+			}
+
+		case ')':
+			if extDepth > 0 {
+				tks = append(tks, tokenCloseParen)
+				extDepth--
+			} else {
+				tks = append(tks, token(')'))
+			}
+
 		case '{', '}', ',':
+			if c == '{' && cfg.allowSegmentRepetition && len(tks) > 0 {
+				// Segment repetition, e.g. */{1,3} or **{0,2}?
+				m := repeatRE.FindStringSubmatch(p[i:])
+				if last := tks[len(tks)-1]; (last == '/' || last == tokenDoubleStar) && m != nil && m[0] != "{}" {
+					tks = append(tks, tokenOpenRepeat)
+					tks = appendLiterals(tks, m[1])
+					if m[2] != "" {
+						tks = append(tks, tokenComma)
+						tks = appendLiterals(tks, m[3])
+					}
+					tks = append(tks, tokenCloseRepeat)
+					skipTo = i + len(m[0])
+					break
+				}
+			}
+			if c == '{' && cfg.allowAlternation && cfg.allowBraceSequence {
+				// Brace sequence?
+				if m := braceSequenceRE.FindStringSubmatch(p[i:]); m != nil {
+					tks = append(tks, tokenOpenBrace)
+					tks = appendLiterals(tks, m[1])
+					tks = append(tks, tokenDotDot)
+					tks = appendLiterals(tks, m[2])
+					if m[3] != "" {
+						tks = append(tks, tokenDotDot)
+						tks = appendLiterals(tks, m[3])
+					}
+					tks = append(tks, tokenCloseBrace)
+					skipTo = i + len(m[0])
+					break
+				}
+			}
 			if cfg.allowAlternation {
 				switch c {
 				case '{':
@@ -221,6 +453,81 @@ func tokenise(p string, cfg *parseConfig) *tokens {
 	return &tks
 }
 
+// expandEnvVar returns the value of the environment variable reference
+// matched by envVarRE. Unset variables expand to nothing, and
+// ${VAR:-default} expands to default if VAR is unset or empty.
+func expandEnvVar(m []string, cfg *parseConfig) string {
+	lookup := cfg.lookupEnv
+	if lookup == nil {
+		lookup = os.LookupEnv
+	}
+	name := m[1] + m[2]
+	value, _ := lookup(name)
+	if def, ok := strings.CutPrefix(m[3], ":-"); ok && value == "" {
+		return def
+	}
+	return value
+}
+
+// posixClassName returns the name of the POSIX class (e.g. "alpha" for
+// "[:alpha:]") at the start of s, and the length in bytes of the whole class.
+// If s doesn't start with something that looks like a POSIX class, it returns
+// n = 0.
+func posixClassName(s string) (name string, n int) {
+	rest, ok := strings.CutPrefix(s, "[:")
+	if !ok {
+		return "", 0
+	}
+	name, _, ok = strings.Cut(rest, ":]")
+	if !ok || !isClassName(name) {
+		return "", 0
+	}
+	return name, len(name) + 4
+}
+
+// unicodeClassName returns the name of the Unicode class (e.g. "Han" for
+// "p{Han}") at the start of s, whether it is negated ("P{Han}"), and the
+// length in bytes of the whole class. If s doesn't start with something that
+// looks like a Unicode class, it returns n = 0.
+func unicodeClassName(s string) (name string, negated bool, n int) {
+	if len(s) < 2 || s[1] != '{' {
+		return "", false, 0
+	}
+	switch s[0] {
+	case 'p':
+	case 'P':
+		negated = true
+	default:
+		return "", false, 0
+	}
+	name, _, ok := strings.Cut(s[2:], "}")
+	if !ok || !isClassName(name) {
+		return "", false, 0
+	}
+	return name, negated, len(name) + 3
+}
+
+// isClassName reports whether s could be the name of a named class.
+func isClassName(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, c := range s {
+		if c != '_' && !('a' <= c && c <= 'z') && !('A' <= c && c <= 'Z') {
+			return false
+		}
+	}
+	return true
+}
+
+// appendLiterals appends each rune of s as a literal token.
+func appendLiterals(tks tokens, s string) tokens {
+	for _, c := range s {
+		tks = append(tks, token(c))
+	}
+	return tks
+}
+
 // next uses a pointer to a slice as a consuming reader.
 func (r *tokens) next() (token, bool) {
 	if r == nil || len(*r) == 0 {
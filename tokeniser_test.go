@@ -70,12 +70,153 @@ func TestTokeniser(t *testing.T) {
 				token(']'),
 			},
 		},
+		{
+			pattern: "[-a-z\\-]-",
+			want: &tokens{
+				tokenOpenBracket,
+				tokenDash,
+				token('a'),
+				tokenDash,
+				token('z'),
+				token('-'),
+				tokenCloseBracket,
+				token('-'),
+			},
+		},
+		{
+			pattern: "[[:digit:]\\p{Han}[:x][^\\P{L}]",
+			want: &tokens{
+				tokenOpenBracket,
+				tokenOpenPOSIXClass,
+				token('d'),
+				token('i'),
+				token('g'),
+				token('i'),
+				token('t'),
+				tokenClosePOSIXClass,
+				tokenOpenUnicodeClass,
+				token('H'),
+				token('a'),
+				token('n'),
+				tokenCloseUnicodeClass,
+				token('['),
+				token(':'),
+				token('x'),
+				tokenCloseBracket,
+				tokenBracketCaret,
+				tokenOpenNegUnicodeClass,
+				token('L'),
+				tokenCloseUnicodeClass,
+				tokenCloseBracket,
+			},
+		},
 	}
 
 	// Fix the config in case this test is ever run on Windows.
 	cfg := defaultParseConfig
 	cfg.allowEscaping = true
 	cfg.swapSlashes = false
+	cfg.allowNamedCharClass = true
+
+	for _, test := range tests {
+		got := tokenise(test.pattern, &cfg)
+		if diff := cmp.Diff(got, test.want); diff != "" {
+			t.Errorf("tokenise(%q) diff (-got +want):\n%s", test.pattern, diff)
+		}
+	}
+}
+
+func TestTokeniser_ExtGlob(t *testing.T) {
+	tests := []struct {
+		pattern string
+		want    *tokens
+	}{
+		{
+			pattern: "!(a|b)|)",
+			want: &tokens{
+				tokenExtBang,
+				token('a'),
+				tokenPipe,
+				token('b'),
+				tokenCloseParen,
+				token('|'),
+				token(')'),
+			},
+		},
+		{
+			pattern: "?(*(x)|+(y))@(z)",
+			want: &tokens{
+				tokenExtQuestion,
+				tokenExtStar,
+				token('x'),
+				tokenCloseParen,
+				tokenPipe,
+				tokenExtPlus,
+				token('y'),
+				tokenCloseParen,
+				tokenCloseParen,
+				tokenExtAt,
+				token('z'),
+				tokenCloseParen,
+			},
+		},
+	}
+
+	cfg := defaultParseConfig
+	cfg.allowEscaping = true
+	cfg.swapSlashes = false
+	cfg.allowExtGlob = true
+
+	for _, test := range tests {
+		got := tokenise(test.pattern, &cfg)
+		if diff := cmp.Diff(got, test.want); diff != "" {
+			t.Errorf("tokenise(%q) diff (-got +want):\n%s", test.pattern, diff)
+		}
+	}
+}
+
+func TestTokeniser_BraceSequence(t *testing.T) {
+	tests := []struct {
+		pattern string
+		want    *tokens
+	}{
+		{
+			pattern: "{1..-2..3}{a..b}",
+			want: &tokens{
+				tokenOpenBrace,
+				token('1'),
+				tokenDotDot,
+				token('-'),
+				token('2'),
+				tokenDotDot,
+				token('3'),
+				tokenCloseBrace,
+				tokenOpenBrace,
+				token('a'),
+				tokenDotDot,
+				token('b'),
+				tokenCloseBrace,
+			},
+		},
+		{
+			pattern: "{1..2,3}",
+			want: &tokens{
+				tokenOpenBrace,
+				token('1'),
+				token('.'),
+				token('.'),
+				token('2'),
+				tokenComma,
+				token('3'),
+				tokenCloseBrace,
+			},
+		},
+	}
+
+	cfg := defaultParseConfig
+	cfg.allowEscaping = true
+	cfg.swapSlashes = false
+	cfg.allowBraceSequence = true
 
 	for _, test := range tests {
 		got := tokenise(test.pattern, &cfg)
@@ -0,0 +1,282 @@
+package zzglob
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"slices"
+	"strings"
+)
+
+// maxLiteralChildren is the most names that walking will stat within a
+// directory, rather than reading the directory.
+const maxLiteralChildren = 64
+
+// maxGlobStarts limits how many separate directories a walk is split into
+// by splitRoot.
+const maxGlobStarts = 64
+
+// maxNameLength is the longest name (in runes) that literalChildren will
+// consider. Most filesystems limit names to 255 bytes.
+const maxNameLength = 255
+
+// walk is like fs.WalkDir(gs.fs, ".", fn), except that when the only names
+// that could match within a directory are a few literals (see
+// literalChildren), each is stat-ed instead of reading the directory (see
+// readDirFrom). The walk also stops if gs.cfg.ctx is done.
+func (gs *globState) walk(fn fs.WalkDirFunc) error {
+	info, err := fs.Stat(gs.fs, ".")
+	if err != nil {
+		err = fn(".", nil, err)
+	} else {
+		err = gs.walkDir(".", fs.FileInfoToDirEntry(info), fn)
+	}
+	if err == fs.SkipDir || err == fs.SkipAll {
+		return nil
+	}
+	return err
+}
+
+// walkDir walks name (and everything within it, if it is a directory), in
+// the same way as fs.WalkDir.
+func (gs *globState) walkDir(name string, d fs.DirEntry, fn fs.WalkDirFunc) error {
+	if gs.cfg.ctx != nil {
+		if err := gs.cfg.ctx.Err(); err != nil {
+			return err
+		}
+	}
+	if err := fn(name, d, nil); err != nil || !d.IsDir() {
+		if err == fs.SkipDir && d.IsDir() {
+			// Successfully skipped directory.
+			err = nil
+		}
+		return err
+	}
+	if strings.Count(name, "/") > globSymlinkRecursionLimit {
+		// Only possible by following symlinks.
+		return fmt.Errorf("recursion limit %d reached; possible symlink cycle", globSymlinkRecursionLimit)
+	}
+
+	entries, err := gs.readDir(name)
+	if err != nil {
+		// Second call, to report ReadDir error.
+		err = fn(name, d, err)
+		if err != nil {
+			if err == fs.SkipDir && d.IsDir() {
+				err = nil
+			}
+			return err
+		}
+	}
+
+	for _, d1 := range entries {
+		if err := gs.walkDir(path.Join(name, d1.Name()), d1, fn); err != nil {
+			if err == fs.SkipDir {
+				break
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+// readDir returns the entries of the directory that could match, sorted by
+// name. This is either all of them (from fs.ReadDir), or those that exist out
+// of the literal names that could match next.
+func (gs *globState) readDir(dir string) ([]fs.DirEntry, error) {
+	if !gs.cfg.traverseSymlinks {
+		return fs.ReadDir(gs.fs, dir)
+	}
+	states := gs.states
+	if dir != "." {
+		// walkDirFunc has just pushed the directory, if it could match.
+		if len(gs.dirs) == 0 || gs.dirs[len(gs.dirs)-1].dir != dir {
+			return fs.ReadDir(gs.fs, dir)
+		}
+		states = gs.dirs[len(gs.dirs)-1].states
+	}
+	return gs.readDirFrom(dir, states)
+}
+
+// lstatFS is implemented by filesystems that can stat a symlink itself,
+// rather than what it points to. It is the same as fs.ReadLinkFS (which needs
+// a newer Go), which fs.Sub needs in order to Lstat within a subtree.
+type lstatFS interface {
+	fs.FS
+	ReadLink(name string) (string, error)
+	Lstat(name string) (fs.FileInfo, error)
+}
+
+// readDirFrom is readDir, given the states reached by matching dir. The
+// literal names are stat-ed with Lstat, so that symlinks are passed to the
+// callback as symlinks, as they would be from fs.ReadDir. So this is only
+// done if the filesystem implements Lstat (as os.DirFS and fstest.MapFS do).
+// It is also only done when traversing symlinks, like splitRoot.
+func (gs *globState) readDirFrom(dir string, states stateSet) ([]fs.DirEntry, error) {
+	if !gs.cfg.traverseSymlinks {
+		return fs.ReadDir(gs.fs, dir)
+	}
+	lfs, ok := gs.fs.(lstatFS)
+	if _, lstat := gs.cfg.filesystem.(lstatFS); gs.cfg.filesystem != nil && !lstat {
+		// gs.fs is an fs.Sub of the filesystem, which has Lstat, but falls
+		// back to Stat.
+		ok = false
+	}
+	if !ok {
+		return fs.ReadDir(gs.fs, dir)
+	}
+	names, ok := literalChildren(states)
+	if !ok {
+		return fs.ReadDir(gs.fs, dir)
+	}
+
+	gs.logf("stat-ing %d literal names in %q instead of reading it\n", len(names), dir)
+	entries := make([]fs.DirEntry, 0, len(names))
+	for _, name := range names {
+		fi, err := lfs.Lstat(path.Join(dir, name))
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			// Let reading the directory report the problem (if any).
+			gs.logf("Lstat error %v; reading %q instead\n", err, dir)
+			return fs.ReadDir(gs.fs, dir)
+		}
+		entries = append(entries, fs.FileInfoToDirEntry(fi))
+	}
+	return entries, nil
+}
+
+// literalChildren returns the names (sorted) that could be matched next from
+// the states, and true, if there are only a few, each spelled out literally
+// (e.g. by {api,web}). It returns nil, false if there are too many, or any
+// could contain a wildcard or character class (other than a small range), or
+// if any two names differ only in case (because on some filesystems both
+// would be found, and they are the same file).
+func literalChildren(states stateSet) ([]string, bool) {
+	var names []string
+	var search func(states stateSet, name []rune) bool
+	search = func(states stateSet, name []rune) bool {
+		if len(name) > maxNameLength || len(names) > maxLiteralChildren {
+			return false
+		}
+		var next []rune
+		for s := range states {
+			if s.Accept && len(name) > 0 {
+				names = append(names, string(name))
+			}
+			for _, e := range s.Out {
+				switch x := e.Expr.(type) {
+				case nil:
+					// Already followed by matchSegment.
+				case literalExp:
+					next = append(next, rune(x))
+				case rangeExp:
+					if x.hi-x.lo >= maxPathsRange {
+						return false
+					}
+					for r := x.lo; r <= x.hi; r++ {
+						next = append(next, r)
+					}
+				default:
+					return false
+				}
+			}
+		}
+		slices.Sort(next)
+		for _, r := range slices.Compact(next) {
+			if r == '/' {
+				if len(name) > 0 {
+					names = append(names, string(name))
+				}
+				continue
+			}
+			if !search(matchSegment(states, string(r)), append(name, r)) {
+				return false
+			}
+		}
+		return true
+	}
+	if !search(matchSegment(states, ""), nil) {
+		return nil, false
+	}
+
+	slices.Sort(names)
+	names = slices.Compact(names)
+	if len(names) > maxLiteralChildren {
+		return nil, false
+	}
+	names = slices.DeleteFunc(names, func(n string) bool {
+		// Walking never produces these.
+		return n == "." || n == ".."
+	})
+	for i, n := range names {
+		for _, m := range names[i+1:] {
+			if strings.EqualFold(n, m) {
+				return nil, false
+			}
+		}
+	}
+	return names, true
+}
+
+// globStart is a directory to start walking from, and the states reached by
+// matching it.
+type globStart struct {
+	root   string
+	states stateSet
+}
+
+// splitRoot returns the directories to start walking from, instead of root.
+// As long as the only things that could match within a directory are
+// literally-named subdirectories (e.g. the {api,web}/ in {api,web}/src/*.go),
+// the walk can start in each of those instead. The directory being split
+// must not be a match itself, because the start of a walk isn't reported.
+func splitRoot(cfg *globConfig, root string, states stateSet) []globStart {
+	starts := []globStart{{root: root, states: states}}
+	if cfg.walkIntermediateDirs || !cfg.traverseSymlinks {
+		return starts
+	}
+	for i, splits := 0, 0; i < len(starts) && splits < maxGlobStarts; {
+		st := starts[i]
+		names, ok := literalChildren(st.states)
+		if !ok || len(starts)-1+len(names) > maxGlobStarts {
+			i++
+			continue
+		}
+		var split []globStart
+		for _, name := range names {
+			if anyAccepting(matchSegment(st.states, name)) {
+				// A match here would have to be reported from this
+				// directory's walk.
+				split = nil
+				ok = false
+				break
+			}
+			next := matchSegment(st.states, name+"/")
+			if len(next) == 0 || anyAccepting(next) {
+				ok = false
+				break
+			}
+			split = append(split, globStart{root: path.Join(st.root, name), states: next})
+		}
+		if !ok {
+			i++
+			continue
+		}
+		starts = slices.Replace(starts, i, i+1, split...)
+		splits++
+	}
+	return starts
+}
+
+// anyAccepting reports whether any of the states is accepting.
+func anyAccepting(states stateSet) bool {
+	for s := range states {
+		if s.Accept {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,275 @@
+package zzglob
+
+import (
+	"context"
+	"io/fs"
+	"sort"
+	"testing"
+	"testing/fstest"
+
+	"github.com/google/go-cmp/cmp"
+)
+
+func monorepoFS() *readDirRecorder {
+	return &readDirRecorder{
+		FS: fstest.MapFS{
+			"api/src/a/config.yaml":     {},
+			"api/src/b/config.yaml":     {},
+			"api/src/b/other.yaml":      {},
+			"api/docs/config.yaml":      {},
+			"web/src/c/config.yaml":     {},
+			"web/node_modules/x/y.js":   {},
+			"lib/src/d/config.yaml":     {},
+			"x/build/out/x.tar":         {},
+			"x/build/out/x.zip":         {},
+			"x/build/tmp/y.tar":         {},
+			"y/build/out/y.tar":         {},
+			"y/src/z.go":                {},
+			"z/nothing-to-see-here.txt": {},
+		},
+	}
+}
+
+func TestGlob_LiteralGuided(t *testing.T) {
+	tests := []struct {
+		pattern   string
+		want      []walkFuncArgs
+		wantReads []string
+	}{
+		{
+			pattern: "{api,web}/src/*/config.yaml",
+			want: []walkFuncArgs{
+				{Path: "api/src/a/config.yaml"},
+				{Path: "api/src/b/config.yaml"},
+				{Path: "web/src/c/config.yaml"},
+			},
+			// The walks start in api/src and web/src, and config.yaml is
+			// stat-ed in each subdirectory.
+			wantReads: []string{"api/src", "web/src"},
+		},
+		{
+			pattern: "*/build/out/*.tar",
+			want: []walkFuncArgs{
+				{Path: "x/build/out/x.tar"},
+				{Path: "y/build/out/y.tar"},
+			},
+			wantReads: []string{".", "x/build/out", "y/build/out"},
+		},
+		{
+			pattern: "{api,web,lib}/{src,docs}/**/config.yaml",
+			want: []walkFuncArgs{
+				{Path: "api/docs/config.yaml"},
+				{Path: "api/src/a/config.yaml"},
+				{Path: "api/src/b/config.yaml"},
+				{Path: "lib/src/d/config.yaml"},
+				{Path: "web/src/c/config.yaml"},
+			},
+			// ** needs reading every directory, but web/docs and lib/docs
+			// don't exist.
+			wantReads: []string{"api/docs", "api/src", "api/src/a", "api/src/b", "lib/src", "lib/src/d", "web/src", "web/src/c"},
+		},
+	}
+
+	for _, test := range tests {
+		fsys := monorepoFS()
+		var got walkFuncCalls
+		if err := MustParse(test.pattern).Glob(got.walkFunc, traceLogOpt, WithFilesystem(fsys)); err != nil {
+			t.Fatalf("Glob(...) = %v", err)
+		}
+		got.sortCalls()
+		sort.Strings(fsys.reads)
+
+		if diff := cmp.Diff(got.calls, test.want); diff != "" {
+			t.Errorf("%q walked paths diff (-got +want):\n%s", test.pattern, diff)
+		}
+		if diff := cmp.Diff(fsys.reads, test.wantReads); diff != "" {
+			t.Errorf("%q read directories diff (-got +want):\n%s", test.pattern, diff)
+		}
+	}
+}
+
+func TestGlob_LiteralGuidedAgreesWithReadDir(t *testing.T) {
+	fsys := deepMapFS(4, 3)
+	patterns := []string{
+		"src/{d0,d2}/*/{a.go,README}",
+		"src/d{0..2}/d1/*",
+		"src/*/d1/{d0,d1}/a_test.go",
+		"{src,nope}/d1/**/README",
+		"src/d0/d0/d0/",
+		"src/d0/{d0,d1}/",
+		"src/[d]0/[d]1/a.go",
+	}
+	for _, pattern := range patterns {
+		p, err := Parse(pattern, AllowBraceSequence(true))
+		if err != nil {
+			t.Fatalf("Parse(%q) = %v", pattern, err)
+		}
+
+		// Not traversing symlinks means reading every directory.
+		var got, want walkFuncCalls
+		if err := p.Glob(got.walkFunc, traceLogOpt, WithFilesystem(fsys)); err != nil {
+			t.Fatalf("Glob(...) = %v", err)
+		}
+		if err := p.Glob(want.walkFunc, traceLogOpt, WithFilesystem(fsys), TraverseSymlinks(false)); err != nil {
+			t.Fatalf("Glob(..., TraverseSymlinks(false)) = %v", err)
+		}
+		got.sortCalls()
+		want.sortCalls()
+		if len(want.calls) == 0 {
+			t.Errorf("%q matches nothing in the test filesystem", pattern)
+		}
+		if diff := cmp.Diff(got.calls, want.calls); diff != "" {
+			t.Errorf("%q walked paths diff (-got +want):\n%s", pattern, diff)
+		}
+	}
+}
+
+func TestGlob_LiteralGuidedSymlink(t *testing.T) {
+	fsys := &readDirRecorder{
+		FS: fstest.MapFS{
+			"src/d/file": {},
+			"src/d/link": {Mode: fs.ModeSymlink, Data: []byte("file")},
+		},
+	}
+	p := MustParse("src/*/{file,link}")
+
+	// Symlinks are passed to the callback as symlinks, whether the names are
+	// stat-ed or the directory is read.
+	type call struct {
+		Path string
+		Type fs.FileMode
+	}
+	var got []call
+	err := p.Glob(func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		got = append(got, call{path, d.Type()})
+		return nil
+	}, traceLogOpt, WithFilesystem(fsys))
+	if err != nil {
+		t.Fatalf("Glob(...) = %v", err)
+	}
+	want := []call{
+		{"src/d/file", 0},
+		{"src/d/link", fs.ModeSymlink},
+	}
+	if diff := cmp.Diff(got, want); diff != "" {
+		t.Errorf("walked paths diff (-got +want):\n%s", diff)
+	}
+	if diff := cmp.Diff(fsys.reads, []string{"src"}); diff != "" {
+		t.Errorf("read directories diff (-got +want):\n%s", diff)
+	}
+}
+
+func TestGlob_LiteralGuided_CaseInsensitive(t *testing.T) {
+	fsys := monorepoFS()
+	p, err := Parse("{api,web}/SRC/*/config.yaml", CaseInsensitive(true))
+	if err != nil {
+		t.Fatalf("Parse(...) = %v", err)
+	}
+	var got walkFuncCalls
+	if err := p.Glob(got.walkFunc, traceLogOpt, WithFilesystem(fsys)); err != nil {
+		t.Fatalf("Glob(...) = %v", err)
+	}
+	got.sortCalls()
+
+	// Names differing only by case aren't stat-ed, since they could be the
+	// same file, so every directory is read.
+	want := []walkFuncArgs{
+		{Path: "api/src/a/config.yaml"},
+		{Path: "api/src/b/config.yaml"},
+		{Path: "web/src/c/config.yaml"},
+	}
+	if diff := cmp.Diff(got.calls, want); diff != "" {
+		t.Errorf("walked paths diff (-got +want):\n%s", diff)
+	}
+}
+
+func TestSplitRoot(t *testing.T) {
+	tests := []struct {
+		pattern string
+		want    []string
+	}{
+		{"{api,web}/src/*/config.yaml", []string{"api/src", "web/src"}},
+		{"src/{a,b/c}/*.go", []string{"src/a", "src/b/c"}},
+		{"src/{a,b}/{c,d}/*.go", []string{"src/a/c", "src/a/d", "src/b/c", "src/b/d"}},
+		{"src/{a,b}/{c,d}/**", []string{"src/a", "src/b"}}, // src/a/c/ is a match
+		{"src/{a,b*}/*.go", []string{"src"}},
+		{"src/{a,b}*.go", []string{"src"}},   // a*.go could match a file in src
+		{"src/{a/,b/x}/", []string{"src/b"}}, // b/x/ is a match in b, and a// can't be walked
+		{"src/{a,b}/", []string{"src"}},      // src/a/ is a match
+		{"*/src/*.go", []string{"."}},        // not literal
+		{"{a,A}/x/*", []string{"."}},         // might be the same directory
+		{"/etc/{a,b}.d/*.conf", []string{"/etc/a.d", "/etc/b.d"}},
+	}
+
+	cfg := &globConfig{traverseSymlinks: true}
+	for _, test := range tests {
+		p := MustParse(test.pattern)
+		var got []string
+		for _, st := range p.globStarts(cfg) {
+			got = append(got, st.root)
+		}
+		if diff := cmp.Diff(got, test.want); diff != "" {
+			t.Errorf("%q globStarts roots diff (-got +want):\n%s", test.pattern, diff)
+		}
+	}
+}
+
+func TestGlob_SplitRootSkipAll(t *testing.T) {
+	fsys := fstest.MapFS{
+		"a/x/1": {},
+		"b/x/1": {},
+	}
+	p := MustParse("{a,b}/x/*")
+	if got := len(p.globStarts(&globConfig{traverseSymlinks: true})); got != 2 {
+		t.Fatalf("len(globStarts) = %d, want 2", got)
+	}
+
+	// fs.SkipAll stops the whole glob, not only the walk from one root.
+	for _, parallelism := range []int{1, 4} {
+		var got []string
+		err := p.Glob(func(path string, d fs.DirEntry, err error) error {
+			got = append(got, path)
+			return fs.SkipAll
+		}, traceLogOpt, WithFilesystem(fsys), Parallelism(parallelism))
+		if err != nil {
+			t.Fatalf("Glob(..., Parallelism(%d)) = %v", parallelism, err)
+		}
+		if want := []string{"a/x"}; !cmp.Equal(got, want) {
+			t.Errorf("Glob(..., Parallelism(%d)) called back with %q, want %q", parallelism, got, want)
+		}
+	}
+}
+
+func TestMultiGlob_LiteralGuided(t *testing.T) {
+	fsys := monorepoFS()
+	patterns := []*Pattern{
+		MustParse("{api,web}/src/*/config.yaml"),
+		MustParse("api/src/*/other.yaml"),
+	}
+
+	var got walkFuncCalls
+	if err := MultiGlob(context.Background(), patterns, got.walkFunc, traceLogOpt, WithFilesystem(fsys)); err != nil {
+		t.Fatalf("MultiGlob(...) = %v", err)
+	}
+	got.sortCalls()
+	sort.Strings(fsys.reads)
+
+	want := []walkFuncArgs{
+		{Path: "api/src/a/config.yaml"},
+		{Path: "api/src/b/config.yaml"},
+		{Path: "api/src/b/other.yaml"},
+		{Path: "web/src/c/config.yaml"},
+	}
+	if diff := cmp.Diff(got.calls, want); diff != "" {
+		t.Errorf("walked paths diff (-got +want):\n%s", diff)
+	}
+
+	// api/src is shared between both patterns, so only read once.
+	wantReads := []string{"api/src", "web/src"}
+	if diff := cmp.Diff(fsys.reads, wantReads); diff != "" {
+		t.Errorf("read directories diff (-got +want):\n%s", diff)
+	}
+}